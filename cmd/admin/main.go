@@ -0,0 +1,77 @@
+// Entry point for bootstrapping admins
+// go run cmd/admin/main.go -email admin@example.com -password <password> [-first Admin -last User]
+// promotes the user if the email is already registered, creates a new admin otherwise
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/db"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/services/user"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the admin")
+	password := flag.String("password", "", "password, only needed when the user doesn't exist yet")
+	firstName := flag.String("first", "Admin", "first name, only used when creating the user")
+	lastName := flag.String("last", "User", "last name, only used when creating the user")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+
+	db, err := db.NewMySQLStorage(mysql.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := user.NewStore(db)
+
+	// existing user, just promote
+	if u, err := store.GetUserByEmail(*email); err == nil {
+		if err := store.UpdateUserRole(u.ID, types.RoleAdmin); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("user %s promoted to admin", *email)
+		return
+	}
+
+	if *password == "" {
+		log.Fatal("-password is required to create a new admin")
+	}
+	if err := auth.LoadBreachedPasswords(config.Envs.BreachedPasswordsFile); err != nil {
+		log.Fatal(err)
+	}
+	if problems := auth.CheckPassword(*password, *email, *firstName, *lastName); len(problems) > 0 {
+		log.Fatalf("-password %s", strings.Join(problems, ", "))
+	}
+	hashedPassword, err := auth.HashPassword(*password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = store.CreateUser(types.User{
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Email:     *email,
+		Password:  hashedPassword,
+		Role:      types.RoleAdmin,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("admin %s created", *email)
+}
@@ -1,13 +1,25 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/mailer"
+	"github.com/faldeus0092/go-ecom/search"
+	"github.com/faldeus0092/go-ecom/services/address"
+	"github.com/faldeus0092/go-ecom/services/apikey"
+	"github.com/faldeus0092/go-ecom/services/audit"
+	"github.com/faldeus0092/go-ecom/services/auth"
 	"github.com/faldeus0092/go-ecom/services/cart"
+	"github.com/faldeus0092/go-ecom/services/category"
+	"github.com/faldeus0092/go-ecom/services/export"
 	"github.com/faldeus0092/go-ecom/services/order"
 	"github.com/faldeus0092/go-ecom/services/product"
+	"github.com/faldeus0092/go-ecom/services/session"
 	"github.com/faldeus0092/go-ecom/services/user"
 	"github.com/gorilla/mux"
 )
@@ -25,21 +37,67 @@ func NewAPIServer(addr string, db *sql.DB) *APIServer {
 }
 
 func (s *APIServer) Run() error {
+	mail, err := mailer.NewMailer(config.Envs)
+	if err != nil {
+		return err
+	}
+
 	router := mux.NewRouter()
+	// public keys for services verifying our access tokens
+	router.HandleFunc("/.well-known/jwks.json", auth.HandleJWKS).Methods(http.MethodGet)
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
 
+	sessionStore := session.NewStore(s.db)
+	auditStore := audit.NewStore(s.db)
+	auth.EnableImpersonation(auditStore)
+	apiKeyStore := apikey.NewStore(s.db)
+
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+	lockout := time.Duration(config.Envs.LoginLockoutInSeconds) * time.Second
+	accountLimiter := auth.NewMemoryLoginLimiter(int(config.Envs.LoginFreeFailures), int(config.Envs.LoginMaxFailures), lockout)
+	ipLimiter := auth.NewMemoryLoginLimiter(int(config.Envs.LoginFreeFailuresPerIP), int(config.Envs.LoginMaxFailuresPerIP), lockout)
+	exportStore := export.NewStore(s.db)
+	userHandler := user.NewHandler(userStore, sessionStore, mail, accountLimiter, ipLimiter, auditStore, exportStore)
+	if config.Envs.OIDCIssuerURL != "" {
+		provider, err := auth.NewOIDCProvider(context.Background(), config.Envs)
+		if err != nil {
+			return err
+		}
+		userHandler.EnableOIDC(provider)
+	}
 	userHandler.RegisterRoutes(subrouter) //register the user routes by passing the mux router
 
-	productStore := product.NewStore(s.db)
-	productHandler := product.NewHandler(productStore)
+	// products and their variants, stock and prices per SKU
+	catalogStore := product.NewStore(s.db)
+	searchIndex, err := search.NewSearchIndex(config.Envs, s.db, catalogStore)
+	if err != nil {
+		return err
+	}
+	// every write that changes a product, its variants or their stock (placed orders) goes through the index
+	productStore := search.NewIndexedProductStore(catalogStore, searchIndex)
+	variantStore := search.NewIndexedVariantStore(catalogStore, catalogStore, searchIndex)
+	categoryStore := category.NewStore(s.db)
+	productHandler := product.NewHandler(productStore, variantStore, searchIndex, categoryStore, userStore, sessionStore, apiKeyStore)
 	productHandler.RegisterRoutes(subrouter)
 
-	orderStore := order.NewStore(s.db)
-	cartHandler := cart.NewHandler(orderStore, productStore, userStore)
+	categoryHandler := category.NewHandler(categoryStore, productStore, userStore, sessionStore, apiKeyStore)
+	categoryHandler.RegisterRoutes(subrouter)
+
+	addressStore := address.NewStore(s.db)
+	addressHandler := address.NewHandler(addressStore, userStore, sessionStore)
+	addressHandler.RegisterRoutes(subrouter)
+
+	orderStore := search.NewIndexedOrderStore(order.NewStore(s.db), catalogStore, searchIndex)
+	cartHandler := cart.NewHandler(orderStore, productStore, variantStore, userStore, sessionStore, apiKeyStore, addressStore, mail)
 	cartHandler.RegisterRoutes(subrouter)
 
+	exportHandler := export.NewHandler(exportStore, userStore, orderStore, addressStore, sessionStore)
+	exportHandler.RegisterRoutes(subrouter)
+	exportHandler.StartCleanup()
+
+	apiKeyHandler := apikey.NewHandler(apiKeyStore, userStore, sessionStore, auditStore)
+	apiKeyHandler.RegisterRoutes(subrouter)
+
 	// run server, db not yet used
 	log.Println("Listening on", s.addr)
 	return http.ListenAndServe(s.addr, router)
@@ -0,0 +1,91 @@
+// Builds the breached password filter for BREACHED_PASSWORDS_FILE
+// go run cmd/breached/main.go -input passwords.txt -output breached.bin [-sha1] [-fp 0.001]
+// the input has one password per line, or with -sha1 one hex SHA-1 per line ("HASH" or "HASH:count",
+// like the Pwned Passwords downloads), so the plain passwords never have to be on the machine
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+)
+
+func main() {
+	input := flag.String("input", "", "file with one password or SHA-1 per line")
+	output := flag.String("output", "breached.bin", "where to write the filter")
+	hashed := flag.Bool("sha1", false, "the input lines are SHA-1 hashes instead of passwords")
+	falsePositiveRate := flag.Float64("fp", 0.001, "share of good passwords wrongly reported as breached")
+	flag.Parse()
+
+	if *input == "" {
+		log.Fatal("-input is required")
+	}
+
+	// the filter is sized up front, so count the lines first
+	count := 0
+	if err := eachLine(*input, func(string) error { count++; return nil }); err != nil {
+		log.Fatal(err)
+	}
+
+	filter := auth.NewBreachedPasswords(count, *falsePositiveRate)
+	err := eachLine(*input, func(line string) error {
+		if !*hashed {
+			filter.Add(line)
+			return nil
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		digest, err := hex.DecodeString(hash)
+		if err != nil || len(digest) != sha1.Size {
+			log.Printf("skipping invalid SHA-1 %q", hash)
+			return nil
+		}
+		filter.AddSHA1([sha1.Size]byte(digest))
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if _, err := filter.WriteTo(w); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d passwords written to %s", count, *output)
+}
+
+// empty lines are skipped
+func eachLine(file string, fn func(line string) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"database/sql"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/faldeus0092/go-ecom/cmd/api"
 	"github.com/faldeus0092/go-ecom/config"
 	"github.com/faldeus0092/go-ecom/db"
+	"github.com/faldeus0092/go-ecom/services/auth"
 	"github.com/go-sql-driver/mysql"
 )
 
@@ -24,6 +28,13 @@ func main() {
 		log.Fatal(err)
 	}
 	initStorage(db)
+	if err := auth.LoadKeys(config.Envs.JWTSigningKeyFile, config.Envs.JWTVerificationKeysDir); err != nil {
+		log.Fatal(err)
+	}
+	go reloadKeysOnHangup()
+	if err := auth.LoadBreachedPasswords(config.Envs.BreachedPasswordsFile); err != nil {
+		log.Fatal(err)
+	}
 	server := api.NewAPIServer(":8080", db)
 	if err := server.Run(); err != nil {
 		log.Fatal(err)
@@ -36,4 +47,16 @@ func initStorage(db *sql.DB)  {
 		log.Fatal(err)
 	}
 	log.Println("DB Successfully Connected")
-}
\ No newline at end of file
+}
+
+// kill -HUP <pid> reloads the JWT keys, see auth.LoadKeys for the rotation steps
+func reloadKeysOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		// keep the old keys if the new ones are broken
+		if err := auth.LoadKeys(config.Envs.JWTSigningKeyFile, config.Envs.JWTVerificationKeysDir); err != nil {
+			log.Printf("failed to reload JWT keys: %v", err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `refresh_tokens`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `userId` INT UNSIGNED NOT NULL,
+    `sessionId` CHAR(32) NOT NULL,
+    `tokenHash` CHAR(64) NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`tokenHash`),
+    KEY (`sessionId`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN `role` ENUM('customer', 'staff', 'admin') NOT NULL DEFAULT 'customer';
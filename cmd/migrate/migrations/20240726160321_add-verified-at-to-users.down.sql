@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `verifiedAt`, DROP COLUMN `verificationSentAt`;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN `verifiedAt` TIMESTAMP NULL DEFAULT NULL,
+    ADD COLUMN `verificationSentAt` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN `totpSecret` VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN `totpEnabledAt` TIMESTAMP NULL DEFAULT NULL,
+    ADD COLUMN `totpLastStep` BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `userId` INT UNSIGNED NOT NULL,
+    `codeHash` CHAR(64) NOT NULL,
+    `usedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    KEY (`userId`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `login_attempts`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `userId` INT UNSIGNED NULL DEFAULT NULL,
+    `email` VARCHAR(255) NOT NULL,
+    `ip` VARCHAR(45) NOT NULL,
+    `userAgent` VARCHAR(255) NOT NULL,
+    `success` BOOLEAN NOT NULL,
+    `reason` VARCHAR(64) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    KEY (`userId`),
+    KEY (`email`),
+    KEY (`ip`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
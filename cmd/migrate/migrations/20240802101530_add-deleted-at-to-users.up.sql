@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `deletedAt` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `audit_log`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `actorId` INT UNSIGNED NULL DEFAULT NULL,
+    `action` VARCHAR(64) NOT NULL,
+    `targetType` VARCHAR(32) NOT NULL,
+    `targetId` VARCHAR(64) NOT NULL,
+    `details` TEXT NOT NULL,
+    `ip` VARCHAR(45) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    KEY (`actorId`),
+    KEY (`targetType`, `targetId`)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `data_exports`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `userId` INT UNSIGNED NOT NULL,
+    `status` ENUM('pending', 'ready', 'failed') NOT NULL DEFAULT 'pending',
+    `filePath` VARCHAR(255) NOT NULL DEFAULT '',
+    `expiresAt` TIMESTAMP NULL DEFAULT NULL,
+    `completedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    KEY (`userId`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `api_keys`(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `name` VARCHAR(100) NOT NULL,
+    `prefix` CHAR(8) NOT NULL,
+    `secretHash` CHAR(64) NOT NULL,
+    `scopes` VARCHAR(255) NOT NULL,
+    `createdBy` INT UNSIGNED NOT NULL,
+    `expiresAt` TIMESTAMP NULL DEFAULT NULL,
+    `lastUsedAt` TIMESTAMP NULL DEFAULT NULL,
+    `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`prefix`),
+    FOREIGN KEY (`createdBy`) REFERENCES users(`id`)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `sessions`(
+    `id` CHAR(32) NOT NULL,
+    `userId` INT UNSIGNED NOT NULL,
+    `userAgent` VARCHAR(255) NOT NULL,
+    `ip` VARCHAR(45) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `lastSeenAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+
+    PRIMARY KEY (id),
+    KEY (`userId`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
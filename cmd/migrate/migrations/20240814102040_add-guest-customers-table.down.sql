@@ -0,0 +1 @@
+DROP TABLE IF EXISTS guest_customers;
\ No newline at end of file
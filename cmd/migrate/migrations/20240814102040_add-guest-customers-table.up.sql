@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS guest_customers(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `email` VARCHAR(255) NOT NULL,
+    `userId` INT UNSIGNED NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`email`),
+    FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
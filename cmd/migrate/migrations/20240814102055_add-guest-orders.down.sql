@@ -0,0 +1 @@
+ALTER TABLE orders DROP FOREIGN KEY `fk_orders_guest_customer`, DROP COLUMN `guestCustomerId`, MODIFY `userId` INT UNSIGNED NOT NULL;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    MODIFY `userId` INT UNSIGNED NULL DEFAULT NULL,
+    ADD COLUMN `guestCustomerId` INT UNSIGNED NULL DEFAULT NULL,
+    ADD CONSTRAINT `fk_orders_guest_customer` FOREIGN KEY (`guestCustomerId`) REFERENCES guest_customers(`id`);
@@ -0,0 +1 @@
+ALTER TABLE orders DROP COLUMN `shippingAddress`;
\ No newline at end of file
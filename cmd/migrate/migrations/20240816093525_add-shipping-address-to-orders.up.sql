@@ -0,0 +1 @@
+ALTER TABLE orders ADD COLUMN `shippingAddress` JSON NULL DEFAULT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `suspendedAt`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `suspendedAt` TIMESTAMP NULL DEFAULT NULL;
\ No newline at end of file
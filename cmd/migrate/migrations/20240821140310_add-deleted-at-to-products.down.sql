@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN `deletedAt`;
\ No newline at end of file
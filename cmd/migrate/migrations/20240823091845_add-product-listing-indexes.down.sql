@@ -0,0 +1 @@
+ALTER TABLE products DROP INDEX `idx_products_createdAt`, DROP INDEX `idx_products_price`, DROP INDEX `idx_products_name`;
\ No newline at end of file
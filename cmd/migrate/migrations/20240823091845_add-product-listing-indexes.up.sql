@@ -0,0 +1 @@
+ALTER TABLE products ADD INDEX `idx_products_createdAt` (`createdAt`, `id`), ADD INDEX `idx_products_price` (`price`, `id`), ADD INDEX `idx_products_name` (`name`, `id`);
\ No newline at end of file
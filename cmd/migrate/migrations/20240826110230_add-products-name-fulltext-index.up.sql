@@ -0,0 +1 @@
+ALTER TABLE products ADD FULLTEXT INDEX `ft_products_name` (`name`) WITH PARSER ngram;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS categories(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `parentId` INT UNSIGNED NULL DEFAULT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `slug` VARCHAR(100) NOT NULL,
+    `position` INT NOT NULL DEFAULT 0,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`slug`),
+    KEY (`parentId`),
+    FOREIGN KEY (`parentId`) REFERENCES categories(`id`)
+);
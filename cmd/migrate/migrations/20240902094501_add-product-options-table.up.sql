@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS product_options(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `productId` INT UNSIGNED NOT NULL,
+    `name` VARCHAR(50) NOT NULL,
+    `position` INT NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`productId`, `name`),
+    FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS product_variants(
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `productId` INT UNSIGNED NOT NULL,
+    `sku` VARCHAR(64) NOT NULL,
+    `options` JSON NOT NULL,
+    `price` DECIMAL(10, 2) NULL DEFAULT NULL,
+    `quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+    `image` VARCHAR(255) NOT NULL DEFAULT '',
+    `isDefault` BOOLEAN NOT NULL DEFAULT FALSE,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `deletedAt` TIMESTAMP NULL DEFAULT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE KEY (`sku`),
+    KEY (`productId`),
+    FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
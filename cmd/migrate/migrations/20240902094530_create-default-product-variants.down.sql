@@ -0,0 +1,3 @@
+UPDATE products p
+JOIN (SELECT productId, SUM(quantity) AS quantity FROM product_variants WHERE deletedAt IS NULL GROUP BY productId) v ON v.productId = p.id
+SET p.quantity = v.quantity;
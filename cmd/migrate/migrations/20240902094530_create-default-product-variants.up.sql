@@ -0,0 +1,2 @@
+INSERT INTO product_variants (productId, sku, options, quantity, isDefault)
+SELECT id, CONCAT('P', id), JSON_OBJECT(), quantity, TRUE FROM products;
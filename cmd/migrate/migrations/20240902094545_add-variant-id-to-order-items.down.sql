@@ -0,0 +1 @@
+ALTER TABLE order_items DROP FOREIGN KEY `fk_order_items_variant`, DROP COLUMN `variantId`;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE order_items ADD COLUMN `variantId` INT UNSIGNED NULL DEFAULT NULL,
+    ADD CONSTRAINT `fk_order_items_variant` FOREIGN KEY (`variantId`) REFERENCES product_variants(`id`);
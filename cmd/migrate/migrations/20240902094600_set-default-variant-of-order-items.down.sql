@@ -0,0 +1 @@
+UPDATE order_items SET variantId = NULL;
\ No newline at end of file
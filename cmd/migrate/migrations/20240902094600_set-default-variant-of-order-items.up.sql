@@ -0,0 +1,3 @@
+UPDATE order_items oi
+JOIN product_variants v ON v.productId = oi.productId AND v.isDefault
+SET oi.variantId = v.id;
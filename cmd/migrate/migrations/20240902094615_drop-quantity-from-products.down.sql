@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN `quantity` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `price`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN `quantity`;
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -18,6 +19,67 @@ type Config struct {
 	DBName     string
 	JWTExpirationInSeconds int64
 	JWTSecret string
+	JWTSigningKeyFile string
+	JWTVerificationKeysDir string
+	JWTIssuer string
+	JWTAudience string
+	JWTClockSkewInSeconds int64
+	RefreshTokenExpirationInSeconds int64
+	TwoFactorChallengeExpirationInSeconds int64
+	ImpersonationExpirationInSeconds int64
+	LoginFreeFailures int64
+	LoginMaxFailures int64
+	LoginFreeFailuresPerIP int64
+	LoginMaxFailuresPerIP int64
+	LoginLockoutInSeconds int64
+	TrustProxyHeaders bool
+	// roles that can't use their privileges until they enabled 2FA
+	TwoFactorRequiredRoles []string
+	PasswordResetExpirationInSeconds int64
+	EmailVerificationExpirationInSeconds int64
+	EmailVerificationResendIntervalInSeconds int64
+	RequireVerifiedEmailForLogin bool
+	RequireVerifiedEmailForCheckout bool
+	GuestCheckout bool
+	OrderLookupExpirationInSeconds int64
+	// argon2id (default) or bcrypt, for new hashes. old hashes are upgraded on login
+	PasswordHasher string
+	Argon2Memory int64 // KiB
+	Argon2Iterations int64
+	Argon2Parallelism int64
+	BcryptCost int64
+	PasswordMinLength int64
+	PasswordMaxLength int64
+	PasswordMinCharacterClasses int64
+	PasswordForbidPersonalInfo bool
+	// bloom filter built with cmd/breached, no breach check without it
+	BreachedPasswordsFile string
+	// where personal data exports are written, and how long their download link works
+	DataExportDir string
+	DataExportExpirationInSeconds int64
+
+	// mysql (FULLTEXT, default) or memory, for product search
+	SearchIndex string
+
+	// shown in authenticator apps
+	AppName string
+	// where links in emails point to
+	AppURL string
+
+	// social login, disabled without an issuer URL
+	OIDCProviderName string
+	OIDCIssuerURL string
+	OIDCClientID string
+	OIDCClientSecret string
+	OIDCRedirectURL string
+
+	Mailer        string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUser      string
+	SMTPPassword  string
 }
 
 // GLOBAL var
@@ -25,9 +87,12 @@ var Envs = initConfig()
 
 func initConfig() Config {
 	godotenv.Load()
+	publicHost := getEnv("PUBLIC_HOST", "http://localhost")
+	port := getEnv("PORT", "8080")
+	appURL := getEnv("APP_URL", fmt.Sprintf("%s:%s", publicHost, port))
 	return Config{
-		PublicHost: getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:       getEnv("PORT", "8080"),
+		PublicHost: publicHost,
+		Port:       port,
 		DBUser:     getEnv("DB_USER", "root"),
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBAddress:  fmt.Sprintf("%s:%s", 
@@ -35,7 +100,60 @@ func initConfig() Config {
 								getEnv("DB_PORT", "3306")),
 		DBName:     getEnv("DB_NAME", "ecom"),
 		JWTSecret: getEnv("JWT_SECRET", "not-so-secret-anymore"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", int64(3600*24*7)),
+		JWTSigningKeyFile: getEnv("JWT_SIGNING_KEY_FILE", ""),
+		JWTVerificationKeysDir: getEnv("JWT_VERIFICATION_KEYS_DIR", ""),
+		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", int64(60*15)),
+		JWTIssuer: getEnv("JWT_ISSUER", "go-ecom"),
+		JWTAudience: getEnv("JWT_AUDIENCE", "go-ecom-api"),
+		JWTClockSkewInSeconds: getEnvAsInt("JWT_CLOCK_SKEW", 30),
+		RefreshTokenExpirationInSeconds: getEnvAsInt("REFRESH_TOKEN_EXP", int64(3600*24*30)),
+		TwoFactorChallengeExpirationInSeconds: getEnvAsInt("TWO_FACTOR_CHALLENGE_EXP", int64(60*5)),
+		ImpersonationExpirationInSeconds: getEnvAsInt("IMPERSONATION_EXP", int64(60*15)),
+		TwoFactorRequiredRoles: getEnvAsList("REQUIRE_2FA_ROLES", nil),
+		// failures before the backoff starts, and before the lockout
+		LoginFreeFailures: getEnvAsInt("LOGIN_FREE_FAILURES", 3),
+		LoginMaxFailures: getEnvAsInt("LOGIN_MAX_FAILURES", 10),
+		// many users can share an IP (NAT, offices), so it gets more room
+		LoginFreeFailuresPerIP: getEnvAsInt("LOGIN_FREE_FAILURES_PER_IP", 20),
+		LoginMaxFailuresPerIP: getEnvAsInt("LOGIN_MAX_FAILURES_PER_IP", 100),
+		LoginLockoutInSeconds: getEnvAsInt("LOGIN_LOCKOUT", int64(60*15)),
+		TrustProxyHeaders: getEnvAsBool("TRUST_PROXY_HEADERS", false),
+		PasswordResetExpirationInSeconds: getEnvAsInt("PASSWORD_RESET_EXP", int64(3600)),
+		EmailVerificationExpirationInSeconds: getEnvAsInt("EMAIL_VERIFICATION_EXP", int64(3600*24)),
+		EmailVerificationResendIntervalInSeconds: getEnvAsInt("EMAIL_VERIFICATION_RESEND_INTERVAL", int64(60)),
+		RequireVerifiedEmailForLogin: getEnvAsBool("REQUIRE_VERIFIED_EMAIL_FOR_LOGIN", false),
+		RequireVerifiedEmailForCheckout: getEnvAsBool("REQUIRE_VERIFIED_EMAIL_FOR_CHECKOUT", false),
+		GuestCheckout: getEnvAsBool("GUEST_CHECKOUT", true),
+		OrderLookupExpirationInSeconds: getEnvAsInt("ORDER_LOOKUP_EXP", int64(3600*24*90)),
+		PasswordHasher: getEnv("PASSWORD_HASHER", "argon2id"),
+		// RFC 9106 second recommended option
+		Argon2Memory: getEnvAsInt("ARGON2_MEMORY", 64*1024),
+		Argon2Iterations: getEnvAsInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism: getEnvAsInt("ARGON2_PARALLELISM", 4),
+		BcryptCost: getEnvAsInt("BCRYPT_COST", 10),
+		PasswordMinLength: getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength: getEnvAsInt("PASSWORD_MAX_LENGTH", 130),
+		// length beats composition rules, so they're off unless asked for
+		PasswordMinCharacterClasses: getEnvAsInt("PASSWORD_MIN_CHARACTER_CLASSES", 0),
+		PasswordForbidPersonalInfo: getEnvAsBool("PASSWORD_FORBID_PERSONAL_INFO", true),
+		BreachedPasswordsFile: getEnv("BREACHED_PASSWORDS_FILE", ""),
+		DataExportDir: getEnv("DATA_EXPORT_DIR", "exports"),
+		DataExportExpirationInSeconds: getEnvAsInt("DATA_EXPORT_EXP", int64(3600*24)),
+		SearchIndex: getEnv("SEARCH_INDEX", "mysql"),
+		AppName: getEnv("APP_NAME", "go-ecom"),
+		AppURL: appURL,
+		OIDCProviderName: getEnv("OIDC_PROVIDER_NAME", "oidc"),
+		OIDCIssuerURL: getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID: getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL: getEnv("OIDC_REDIRECT_URL", appURL+"/api/v1/auth/oidc/callback"),
+		Mailer: getEnv("MAILER", "outbox"),
+		MailFrom: getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", "outbox"),
+		SMTPHost: getEnv("SMTP_HOST", "localhost"),
+		SMTPPort: getEnv("SMTP_PORT", "587"),
+		SMTPUser: getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 	}
 }
 
@@ -55,4 +173,29 @@ func getEnvAsInt(key string, fallback int64) int64 {
 		return i
 	}
 	return fallback
-}
\ No newline at end of file
+}
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, found := os.LookupEnv(key); found {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fallback
+		}
+		return b
+	}
+	return fallback
+}
+
+// comma separated, empty items are dropped
+func getEnvAsList(key string, fallback []string) []string {
+	if value, found := os.LookupEnv(key); found {
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return fallback
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+// pick the mailer from MAILER, "outbox" (default) or "smtp"
+func NewMailer(cfg config.Config) (types.Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "outbox", "":
+		return NewOutboxMailer(cfg.MailOutboxDir, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+}
+
+// the raw message, headers then the plain text body
+func formatMessage(from string, email types.Email, date string) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, email.To, email.Subject, date, email.Body))
+}
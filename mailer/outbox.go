@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+/* OutboxMailer writes every email as an .eml file in a directory instead of sending it.
+*	for local development and tests, open the files or read them back with Messages
+ */
+type OutboxMailer struct {
+	dir  string
+	from string
+}
+
+func NewOutboxMailer(dir, from string) *OutboxMailer {
+	return &OutboxMailer{dir: dir, from: from}
+}
+
+func (m *OutboxMailer) Send(email types.Email) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	// sortable by time, suffix avoids collisions
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, email, now.Format(time.RFC1123Z)), 0o644)
+}
+
+// every email in the outbox, oldest first
+func (m *OutboxMailer) Messages() ([]types.Email, error) {
+	files, err := filepath.Glob(filepath.Join(m.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	emails := make([]types.Email, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := mail.ReadMessage(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		body, err := io.ReadAll(msg.Body)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, types.Email{
+			To:      msg.Header.Get("To"),
+			Subject: msg.Header.Get("Subject"),
+			Body:    strings.TrimRight(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n"),
+		})
+	}
+	return emails, nil
+}
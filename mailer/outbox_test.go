@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	m := NewOutboxMailer(t.TempDir(), "shop@example.com")
+
+	sent := []types.Email{
+		{To: "first@example.com", Subject: "First", Body: "hello\nworld"},
+		{To: "second@example.com", Subject: "Second", Body: "bye"},
+	}
+	for _, email := range sent {
+		if err := m.Send(email); err != nil {
+			t.Fatalf("error sending email: %v", err)
+		}
+	}
+
+	emails, err := m.Messages()
+	if err != nil {
+		t.Fatalf("error reading outbox: %v", err)
+	}
+	if len(emails) != len(sent) {
+		t.Fatalf("expected %d emails, got %d", len(sent), len(emails))
+	}
+	for i, email := range emails {
+		if email != sent[i] {
+			t.Errorf("expected %+v, got %+v", sent[i], email)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, user, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if user != "" {
+		auth = smtp.PlainAuth("", user, password, host)
+	}
+	return &SMTPMailer{addr: fmt.Sprintf("%s:%s", host, port), auth: auth, from: from}
+}
+
+func (m *SMTPMailer) Send(email types.Email) error {
+	msg := formatMessage(m.from, email, time.Now().Format(time.RFC1123Z))
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{email.To}, msg)
+}
@@ -0,0 +1,167 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+const (
+	// a word in the name counts as much as this many in the description
+	nameWeight = 3
+	// BM25 parameters
+	k1 = 1.2
+	b  = 0.75
+)
+
+/* MemoryIndex is an inverted index kept in the process, ranked with BM25.
+*	for tests and small catalogs, it has to be filled on start (see Rebuild)
+*	and isn't shared between instances
+ */
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	products map[int]types.Product
+	// word => product id => weighted count of the word in the product
+	postings    map[string]map[int]float64
+	lengths     map[int]float64
+	totalLength float64
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		products: make(map[int]types.Product),
+		postings: make(map[string]map[int]float64),
+		lengths:  make(map[int]float64),
+	}
+}
+
+func (m *MemoryIndex) Index(product types.Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(product.ID)
+	if product.DeletedAt != nil {
+		return nil
+	}
+
+	counts := make(map[string]float64)
+	for _, term := range tokenize(product.Name) {
+		counts[term] += nameWeight
+	}
+	for _, term := range tokenize(product.Description) {
+		counts[term]++
+	}
+
+	var length float64
+	for term, count := range counts {
+		if m.postings[term] == nil {
+			m.postings[term] = make(map[int]float64)
+		}
+		m.postings[term][product.ID] = count
+		length += count
+	}
+	m.products[product.ID] = product
+	m.lengths[product.ID] = length
+	m.totalLength += length
+	return nil
+}
+
+func (m *MemoryIndex) Remove(productID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(productID)
+	return nil
+}
+
+// m.mu has to be locked
+func (m *MemoryIndex) remove(productID int) {
+	product, ok := m.products[productID]
+	if !ok {
+		return
+	}
+
+	for _, term := range append(tokenize(product.Name), tokenize(product.Description)...) {
+		if postings, ok := m.postings[term]; ok {
+			delete(postings, productID)
+			if len(postings) == 0 {
+				delete(m.postings, term)
+			}
+		}
+	}
+	m.totalLength -= m.lengths[productID]
+	delete(m.lengths, productID)
+	delete(m.products, productID)
+}
+
+/* Every query word is matched against the words of the index (exact, prefix or with typos),
+*	a product scores the best match of each query word, and less when some query words didn't match
+ */
+func (m *MemoryIndex) Search(query string, limit int) ([]types.SearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := queryTerms(query)
+	results := make([]types.SearchResult, 0)
+	if len(terms) == 0 || len(m.products) == 0 {
+		return results, nil
+	}
+
+	n := float64(len(m.products))
+	avgLength := m.totalLength / n
+	// product id => best score per query word
+	best := make(map[int][]float64)
+	for i, term := range terms {
+		for word, postings := range m.postings {
+			weight := matchTerm(term, word)
+			if weight == 0 {
+				continue
+			}
+			df := float64(len(postings))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for productID, tf := range postings {
+				score := weight * idf * tf * (k1 + 1) / (tf + k1*(1-b+b*m.lengths[productID]/avgLength))
+				if best[productID] == nil {
+					best[productID] = make([]float64, len(terms))
+				}
+				best[productID][i] = max(best[productID][i], score)
+			}
+		}
+	}
+
+	for productID, scores := range best {
+		var score, matched float64
+		for _, s := range scores {
+			if s > 0 {
+				score += s
+				matched++
+			}
+		}
+		product := m.products[productID]
+		results = append(results, types.SearchResult{
+			Product:    product,
+			Score:      score * matched / float64(len(terms)),
+			Highlights: highlights(product, terms),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Product.ID < results[j].Product.ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func highlights(product types.Product, terms []string) types.SearchHighlights {
+	return types.SearchHighlights{
+		Name:        highlight(product.Name, terms, 0),
+		Description: highlight(product.Description, terms, snippetWords),
+	}
+}
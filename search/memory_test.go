@@ -0,0 +1,256 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestMemoryIndex(t *testing.T) {
+	index := NewMemoryIndex()
+	products := []types.Product{
+		{ID: 1, Name: "Gaming laptop", Description: "A fast laptop with a 16 inch screen"},
+		{ID: 2, Name: "Laptop sleeve", Description: "Neoprene sleeve for 13 inch notebooks"},
+		{ID: 3, Name: "Mechanical keyboard", Description: "Works great with any laptop or desktop"},
+		{ID: 4, Name: "Coffee mug", Description: "Ceramic <b>mug</b> & saucer"},
+	}
+	for _, p := range products {
+		if err := index.Index(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(results []types.SearchResult) string {
+		found := make([]string, len(results))
+		for i, r := range results {
+			found[i] = fmt.Sprint(r.Product.ID)
+		}
+		return strings.Join(found, ",")
+	}
+
+	t.Run("should rank matches in the name first", func(t *testing.T) {
+		results, _ := index.Search("laptop", 10)
+		if got := ids(results); got != "1,2,3" {
+			t.Errorf("expected products 1,2,3, got %s", got)
+		}
+	})
+
+	t.Run("should rank products matching every word first", func(t *testing.T) {
+		results, _ := index.Search("laptop sleeve", 10)
+		if len(results) == 0 || results[0].Product.ID != 2 {
+			t.Errorf("expected product 2 first, got %s", ids(results))
+		}
+	})
+
+	t.Run("should tolerate typos and prefixes", func(t *testing.T) {
+		for _, q := range []string{"labtop", "lpatop", "lapt", "keybaord"} {
+			results, _ := index.Search(q, 10)
+			if len(results) == 0 {
+				t.Errorf("expected results for %q", q)
+			}
+		}
+		if results, _ := index.Search("xyz", 10); len(results) != 0 {
+			t.Errorf("expected no results, got %s", ids(results))
+		}
+	})
+
+	t.Run("should highlight the matches", func(t *testing.T) {
+		results, _ := index.Search("mug", 10)
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %s", ids(results))
+		}
+		h := results[0].Highlights
+		if h.Name != "Coffee <mark>mug</mark>" || h.Description != "Ceramic &lt;b&gt;<mark>mug</mark>&lt;/b&gt; &amp; saucer" {
+			t.Errorf("unexpected highlights %+v", h)
+		}
+	})
+
+	t.Run("should follow updates and deletes", func(t *testing.T) {
+		index.Index(types.Product{ID: 4, Name: "Travel mug", Description: "Keeps coffee hot"})
+		if results, _ := index.Search("ceramic", 10); len(results) != 0 {
+			t.Errorf("expected the old description to be gone, got %s", ids(results))
+		}
+		if results, _ := index.Search("travel", 10); ids(results) != "4" {
+			t.Errorf("expected product 4, got %s", ids(results))
+		}
+
+		deletedAt := time.Now()
+		index.Index(types.Product{ID: 4, Name: "Travel mug", DeletedAt: &deletedAt})
+		index.Remove(1)
+		if results, _ := index.Search("travel gaming", 10); len(results) != 0 {
+			t.Errorf("expected no results, got %s", ids(results))
+		}
+	})
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten match eleven twelve thirteen fourteen fifteen"
+	got := highlight(text, []string{"match"}, 6)
+	if got != "…nine ten <mark>match</mark> eleven twelve thirteen…" {
+		t.Errorf("unexpected snippet %q", got)
+	}
+}
+
+func TestIndexedProductStore(t *testing.T) {
+	index := NewMemoryIndex()
+	store := NewIndexedProductStore(&mockProductStore{products: make(map[int]types.Product)}, index)
+
+	id, err := store.CreateProduct(types.Product{Name: "Desk lamp", Description: "LED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := index.Search("lamp", 10); len(results) != 1 || results[0].Product.ID != id {
+		t.Errorf("expected the new product to be indexed, got %+v", results)
+	}
+
+	store.UpdateProduct(types.Product{ID: id, Name: "Floor lamp", Description: "LED"})
+	if results, _ := index.Search("floor", 10); len(results) != 1 {
+		t.Errorf("expected the update to be indexed, got %+v", results)
+	}
+
+	store.DeleteProduct(id)
+	if results, _ := index.Search("lamp", 10); len(results) != 0 {
+		t.Errorf("expected the deleted product to be removed, got %+v", results)
+	}
+}
+
+func TestIndexedOrderStore(t *testing.T) {
+	index := NewMemoryIndex()
+	products := &mockProductStore{products: map[int]types.Product{1: {ID: 1, Name: "Desk lamp", Quantity: 5}}}
+	index.Index(products.products[1])
+	store := NewIndexedOrderStore(&mockOrderStore{products: products}, products, index)
+
+	if _, err := store.PlaceOrder(types.Order{}, []types.OrderItem{{ProductID: 1, Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := index.Search("lamp", 10); len(results) != 1 || results[0].Product.Quantity != 3 {
+		t.Errorf("expected the stock left to be indexed, got %+v", results)
+	}
+}
+
+func TestIndexedVariantStore(t *testing.T) {
+	index := NewMemoryIndex()
+	products := &mockProductStore{products: map[int]types.Product{1: {ID: 1, Name: "Desk lamp", Quantity: 5}}}
+	index.Index(products.products[1])
+	store := NewIndexedVariantStore(&mockVariantStore{products: products}, products, index)
+
+	quantity := func() int {
+		results, _ := index.Search("lamp", 10)
+		if len(results) != 1 {
+			t.Fatalf("expected the product to be found, got %+v", results)
+		}
+		return results[0].Product.Quantity
+	}
+
+	id, _ := store.CreateVariant(types.Variant{ProductID: 1, Quantity: 3})
+	if got := quantity(); got != 8 {
+		t.Errorf("expected quantity 8 after adding a variant, got %d", got)
+	}
+	store.UpdateVariant(types.Variant{ID: id, ProductID: 1, Quantity: 1})
+	if got := quantity(); got != 6 {
+		t.Errorf("expected quantity 6 after the restock, got %d", got)
+	}
+	store.DeleteVariant(id)
+	if got := quantity(); got != 5 {
+		t.Errorf("expected quantity 5 after deleting the variant, got %d", got)
+	}
+}
+
+// keeps the quantity of the products in line with the stock of the variants
+type mockVariantStore struct {
+	types.VariantStore
+	products *mockProductStore
+	variants []types.Variant
+}
+
+func (m *mockVariantStore) CreateVariant(v types.Variant) (int, error) {
+	v.ID = len(m.variants) + 1
+	m.variants = append(m.variants, v)
+	m.restock(v.ProductID, v.Quantity)
+	return v.ID, nil
+}
+
+func (m *mockVariantStore) GetVariantByID(id int) (*types.Variant, error) {
+	for _, v := range m.variants {
+		if v.ID == id {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("variant not found")
+}
+
+func (m *mockVariantStore) UpdateVariant(v types.Variant) error {
+	for i := range m.variants {
+		if m.variants[i].ID == v.ID {
+			m.restock(v.ProductID, v.Quantity-m.variants[i].Quantity)
+			m.variants[i] = v
+		}
+	}
+	return nil
+}
+
+func (m *mockVariantStore) DeleteVariant(id int) error {
+	for i, v := range m.variants {
+		if v.ID == id {
+			m.restock(v.ProductID, -v.Quantity)
+			m.variants = append(m.variants[:i], m.variants[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockVariantStore) restock(productID int, quantity int) {
+	product := m.products.products[productID]
+	product.Quantity += quantity
+	m.products.products[productID] = product
+}
+
+// takes the stock from the products, like the variants would
+type mockOrderStore struct {
+	types.OrderStore
+	products *mockProductStore
+}
+
+func (m *mockOrderStore) PlaceOrder(order types.Order, items []types.OrderItem) (int, error) {
+	for _, item := range items {
+		product := m.products.products[item.ProductID]
+		product.Quantity -= item.Quantity
+		m.products.products[item.ProductID] = product
+	}
+	return 1, nil
+}
+
+// only implements what IndexedProductStore uses, the embedded interface panics on anything else
+type mockProductStore struct {
+	types.ProductStore
+	products map[int]types.Product
+}
+
+func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
+	product.ID = len(m.products) + 1
+	product.CreatedAt = time.Now()
+	m.products[product.ID] = product
+	return product.ID, nil
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
+	product, ok := m.products[id]
+	if !ok {
+		return nil, fmt.Errorf("product not found")
+	}
+	return &product, nil
+}
+
+func (m *mockProductStore) UpdateProduct(product types.Product) error {
+	m.products[product.ID] = product
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int) error {
+	delete(m.products, id)
+	return nil
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"database/sql"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+/* MySQLIndex searches the products table through its FULLTEXT indexes.
+*	they use the ngram parser, so a word with a typo still shares most of its
+*	two letter pieces with the right one and matches, just with a lower score.
+*	MySQL keeps the indexes up to date on every write, Index and Remove have nothing to do
+ */
+type MySQLIndex struct {
+	db *sql.DB
+}
+
+func NewMySQLIndex(db *sql.DB) *MySQLIndex {
+	return &MySQLIndex{db: db}
+}
+
+func (s *MySQLIndex) Index(product types.Product) error {
+	return nil
+}
+
+func (s *MySQLIndex) Remove(productID int) error {
+	return nil
+}
+
+// matches in the name count three times, like in MemoryIndex
+func (s *MySQLIndex) Search(query string, limit int) ([]types.SearchResult, error) {
+	results := make([]types.SearchResult, 0)
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	rows, err := s.db.Query(`SELECT id, name, description, image, price,
+			(SELECT COALESCE(SUM(v.quantity), 0) FROM product_variants v WHERE v.productId = products.id AND v.deletedAt IS NULL),
+			createdAt, deletedAt,
+			MATCH(name) AGAINST(? IN NATURAL LANGUAGE MODE) * 3 + MATCH(name, description) AGAINST(? IN NATURAL LANGUAGE MODE) AS score
+		FROM products
+		WHERE deletedAt IS NULL AND MATCH(name, description) AGAINST(? IN NATURAL LANGUAGE MODE)
+		ORDER BY score DESC, id
+		LIMIT ?`, query, query, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r types.SearchResult
+		err := rows.Scan(&r.Product.ID,
+			&r.Product.Name,
+			&r.Product.Description,
+			&r.Product.Image,
+			&r.Product.Price,
+			&r.Product.Quantity,
+			&r.Product.CreatedAt,
+			&r.Product.DeletedAt,
+			&r.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.Highlights = highlights(r.Product, terms)
+		results = append(results, r)
+	}
+
+	return results, nil
+}
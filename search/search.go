@@ -0,0 +1,185 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+// products read per query by Rebuild
+const rebuildBatch = 500
+
+// pick the index from SEARCH_INDEX, "mysql" (default) or "memory", the memory one is filled from the store
+func NewSearchIndex(cfg config.Config, db *sql.DB, store types.ProductStore) (types.SearchIndex, error) {
+	switch cfg.SearchIndex {
+	case "mysql", "":
+		return NewMySQLIndex(db), nil
+	case "memory":
+		index := NewMemoryIndex()
+		if err := Rebuild(index, store); err != nil {
+			return nil, err
+		}
+		return index, nil
+	default:
+		return nil, fmt.Errorf("unknown search index %q", cfg.SearchIndex)
+	}
+}
+
+// index every product of the catalog
+func Rebuild(index types.SearchIndex, store types.ProductStore) error {
+	query := types.ProductQuery{Sort: types.ProductSortOldest, Limit: rebuildBatch}
+	for {
+		products, err := store.GetProducts(query)
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			if err := index.Index(product); err != nil {
+				return err
+			}
+		}
+		if len(products) < rebuildBatch {
+			return nil
+		}
+		last := products[len(products)-1]
+		query.After = &types.ProductCursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+}
+
+/* IndexedProductStore keeps the search index in sync with the catalog.
+*	the write has already happened when indexing fails, so that's only logged
+ */
+type IndexedProductStore struct {
+	types.ProductStore
+	index types.SearchIndex
+}
+
+func NewIndexedProductStore(store types.ProductStore, index types.SearchIndex) *IndexedProductStore {
+	return &IndexedProductStore{ProductStore: store, index: index}
+}
+
+func (s *IndexedProductStore) CreateProduct(product types.Product) (int, error) {
+	id, err := s.ProductStore.CreateProduct(product)
+	if err != nil {
+		return 0, err
+	}
+
+	// with the id and createdAt set by the database
+	created, err := s.ProductStore.GetProductByID(id)
+	if err != nil {
+		log.Printf("failed to index product %d: %v", id, err)
+		return id, nil
+	}
+	s.indexProduct(*created)
+	return id, nil
+}
+
+func (s *IndexedProductStore) UpdateProduct(product types.Product) error {
+	if err := s.ProductStore.UpdateProduct(product); err != nil {
+		return err
+	}
+	s.indexProduct(product)
+	return nil
+}
+
+func (s *IndexedProductStore) DeleteProduct(id int) error {
+	if err := s.ProductStore.DeleteProduct(id); err != nil {
+		return err
+	}
+	if err := s.index.Remove(id); err != nil {
+		log.Printf("failed to remove product %d from the search index: %v", id, err)
+	}
+	return nil
+}
+
+func (s *IndexedProductStore) indexProduct(product types.Product) {
+	if err := s.index.Index(product); err != nil {
+		log.Printf("failed to index product %d: %v", product.ID, err)
+	}
+}
+
+/* IndexedOrderStore re-indexes the products of a placed order,
+*	the stock taken changes their quantity
+ */
+type IndexedOrderStore struct {
+	types.OrderStore
+	products types.ProductStore
+	index    types.SearchIndex
+}
+
+func NewIndexedOrderStore(store types.OrderStore, products types.ProductStore, index types.SearchIndex) *IndexedOrderStore {
+	return &IndexedOrderStore{OrderStore: store, products: products, index: index}
+}
+
+func (s *IndexedOrderStore) PlaceOrder(order types.Order, items []types.OrderItem) (int, error) {
+	orderID, err := s.OrderStore.PlaceOrder(order, items)
+	if err != nil {
+		return 0, err
+	}
+
+	reindexed := make(map[int]bool)
+	for _, item := range items {
+		if !reindexed[item.ProductID] {
+			reindexed[item.ProductID] = true
+			reindex(s.index, s.products, item.ProductID)
+		}
+	}
+	return orderID, nil
+}
+
+/* IndexedVariantStore re-indexes the product of a changed variant,
+*	its quantity is the stock of all its variants
+ */
+type IndexedVariantStore struct {
+	types.VariantStore
+	products types.ProductStore
+	index    types.SearchIndex
+}
+
+func NewIndexedVariantStore(store types.VariantStore, products types.ProductStore, index types.SearchIndex) *IndexedVariantStore {
+	return &IndexedVariantStore{VariantStore: store, products: products, index: index}
+}
+
+func (s *IndexedVariantStore) CreateVariant(v types.Variant) (int, error) {
+	id, err := s.VariantStore.CreateVariant(v)
+	if err != nil {
+		return 0, err
+	}
+	reindex(s.index, s.products, v.ProductID)
+	return id, nil
+}
+
+func (s *IndexedVariantStore) UpdateVariant(v types.Variant) error {
+	if err := s.VariantStore.UpdateVariant(v); err != nil {
+		return err
+	}
+	reindex(s.index, s.products, v.ProductID)
+	return nil
+}
+
+func (s *IndexedVariantStore) DeleteVariant(id int) error {
+	v, err := s.VariantStore.GetVariantByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.VariantStore.DeleteVariant(id); err != nil {
+		return err
+	}
+	reindex(s.index, s.products, v.ProductID)
+	return nil
+}
+
+// read the product again after a write that changed it indirectly
+func reindex(index types.SearchIndex, products types.ProductStore, productID int) {
+	product, err := products.GetProductByID(productID)
+	if err != nil {
+		log.Printf("failed to index product %d: %v", productID, err)
+		return
+	}
+	if err := index.Index(*product); err != nil {
+		log.Printf("failed to index product %d: %v", productID, err)
+	}
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// words of the description shown around the first match
+	snippetWords = 20
+	ellipsis     = "…"
+)
+
+// lowercased words, anything that isn't a letter or digit separates them
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// the query words without duplicates, in order
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, term := range tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+/* How well a word of a product matches a word of the query, 0 when it doesn't.
+*	exact matches count fully, then prefixes (for search as you type),
+*	then words one typo away (two for long words)
+ */
+func matchTerm(query, word string) float64 {
+	if query == word {
+		return 1
+	}
+	q, w := []rune(query), []rune(word)
+	if len(q) >= 3 && strings.HasPrefix(word, query) {
+		return 0.8
+	}
+
+	maxEdits := 0
+	switch {
+	case len(q) >= 8:
+		maxEdits = 2
+	case len(q) >= 4:
+		maxEdits = 1
+	}
+	if maxEdits == 0 {
+		return 0
+	}
+	switch d := editDistance(q, w, maxEdits); {
+	case d > maxEdits:
+		return 0
+	case d == 1:
+		return 0.6
+	default:
+		return 0.4
+	}
+}
+
+/* Optimal string alignment distance, a swap of two neighbouring letters is one edit.
+*	returns max+1 as soon as the distance is known to be above max
+ */
+func editDistance(a, b []rune, max int) int {
+	if abs(len(a)-len(b)) > max {
+		return max + 1
+	}
+
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return min(prev[len(b)], max+1)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type word struct {
+	start, end int
+	match      bool
+}
+
+/* The text HTML escaped, with the words matching the query wrapped in <mark>.
+*	with a window > 0 only that many words around the first match are kept
+ */
+func highlight(text string, terms []string, window int) string {
+	words := make([]word, 0)
+	start := -1
+	for i, r := range text {
+		if isSeparator(r) {
+			if start >= 0 {
+				words = append(words, word{start: start, end: i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start: start, end: len(text)})
+	}
+
+	first := -1
+	for i := range words {
+		lower := strings.ToLower(text[words[i].start:words[i].end])
+		for _, term := range terms {
+			if matchTerm(term, lower) > 0 {
+				words[i].match = true
+				break
+			}
+		}
+		if words[i].match && first < 0 {
+			first = i
+		}
+	}
+
+	from, to := 0, len(words)
+	if window > 0 && len(words) > window {
+		// the match a third into the snippet, so there's some text before it
+		from = max(first-window/3, 0)
+		to = min(from+window, len(words))
+		from = max(to-window, 0)
+	}
+
+	var b strings.Builder
+	pos := 0
+	if from > 0 {
+		b.WriteString(ellipsis)
+		pos = words[from].start
+	}
+	for _, w := range words[from:to] {
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		if w.match {
+			b.WriteString("<mark>" + html.EscapeString(text[w.start:w.end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[w.start:w.end]))
+		}
+		pos = w.end
+	}
+	if to < len(words) {
+		b.WriteString(ellipsis)
+	} else {
+		b.WriteString(html.EscapeString(text[pos:]))
+	}
+	return b.String()
+}
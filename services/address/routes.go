@@ -0,0 +1,159 @@
+package address
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store        types.AddressStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+}
+
+func NewHandler(store types.AddressStore, userStore types.UserStore, sessionStore types.SessionStore) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore}
+}
+
+// the address book of the logged in user
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/me/addresses", auth.WithJWTAuth(h.handleGetAddresses, h.userStore, h.sessionStore)).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses", auth.WithJWTAuth(h.handleCreateAddress, h.userStore, h.sessionStore)).Methods(http.MethodPost)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleGetAddress, h.userStore, h.sessionStore)).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleUpdateAddress, h.userStore, h.sessionStore)).Methods(http.MethodPut)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleDeleteAddress, h.userStore, h.sessionStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	addresses, err := h.store.GetAddressesByUserID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, addresses)
+}
+
+// the first address of a user becomes the default for shipping and billing
+func (h *Handler) handleCreateAddress(w http.ResponseWriter, r *http.Request) {
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	existing, err := h.store.GetAddressesByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	addressID, err := h.store.CreateAddress(types.Address{
+		UserID:            userID,
+		PostalAddress:     payload.PostalAddress,
+		IsDefaultShipping: payload.IsDefaultShipping || len(existing) == 0,
+		IsDefaultBilling:  payload.IsDefaultBilling || len(existing) == 0,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a, err := h.store.GetAddressByID(addressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, a)
+}
+
+func (h *Handler) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, a)
+}
+
+// replaces the whole address, past orders keep the copy they were placed with
+func (h *Handler) handleUpdateAddress(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	a.PostalAddress = payload.PostalAddress
+	a.IsDefaultShipping = payload.IsDefaultShipping
+	a.IsDefaultBilling = payload.IsDefaultBilling
+	if err := h.store.UpdateAddress(*a); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a, err := h.store.GetAddressByID(a.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAddress(a.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "address deleted"})
+}
+
+// someone else's address answers the same as a missing one
+func (h *Handler) ownAddress(w http.ResponseWriter, r *http.Request) (*types.Address, bool) {
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address id"))
+		return nil, false
+	}
+
+	a, err := h.store.GetAddressByID(addressID)
+	if err != nil || a.UserID != auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("address not found"))
+		return nil, false
+	}
+	return a, true
+}
+
+func parseAddressPayload(w http.ResponseWriter, r *http.Request) (*types.AddressPayload, bool) {
+	var payload types.AddressPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return nil, false
+	}
+	return &payload, true
+}
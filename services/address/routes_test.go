@@ -0,0 +1,169 @@
+package address
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestAddressHandler(t *testing.T) {
+	store := &mockAddressStore{}
+	handler := NewHandler(store, nil, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/me/addresses", handler.handleGetAddresses).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses", handler.handleCreateAddress).Methods(http.MethodPost)
+	router.HandleFunc("/me/addresses/{addressID}", handler.handleGetAddress).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses/{addressID}", handler.handleUpdateAddress).Methods(http.MethodPut)
+	router.HandleFunc("/me/addresses/{addressID}", handler.handleDeleteAddress).Methods(http.MethodDelete)
+
+	serve := func(method, path string, userID int, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	home := types.PostalAddress{Name: "Jane Doe", Line1: "Main Street 1", City: "Amsterdam", PostalCode: "1011 AA", Country: "NL", Phone: "+31201234567"}
+
+	t.Run("should refuse an invalid address", func(t *testing.T) {
+		invalid := home
+		invalid.Country = "Netherlands"
+		if rr := serve(http.MethodPost, "/me/addresses", 1, types.AddressPayload{PostalAddress: invalid}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should make the first address the default", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/me/addresses", 1, types.AddressPayload{PostalAddress: home}); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if a := store.addresses[0]; !a.IsDefaultShipping || !a.IsDefaultBilling {
+			t.Errorf("expected the first address to be the default, got %+v", a)
+		}
+	})
+
+	t.Run("should move the default to a new address", func(t *testing.T) {
+		work := home
+		work.Line1 = "Office Park 5"
+		if rr := serve(http.MethodPost, "/me/addresses", 1, types.AddressPayload{PostalAddress: work, IsDefaultShipping: true}); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if store.addresses[0].IsDefaultShipping || !store.addresses[0].IsDefaultBilling || !store.addresses[1].IsDefaultShipping {
+			t.Errorf("expected only the shipping default to move, got %+v", store.addresses)
+		}
+	})
+
+	t.Run("should update the address", func(t *testing.T) {
+		moved := home
+		moved.Line1 = "Canal Street 2"
+		rr := serve(http.MethodPut, "/me/addresses/1", 1, types.AddressPayload{PostalAddress: moved, IsDefaultBilling: true})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.addresses[0].Line1 != "Canal Street 2" {
+			t.Errorf("expected the address to be updated, got %+v", store.addresses[0])
+		}
+	})
+
+	t.Run("should hide the addresses of other users", func(t *testing.T) {
+		if rr := serve(http.MethodGet, "/me/addresses/1", 2, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve(http.MethodDelete, "/me/addresses/1", 2, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		rr := serve(http.MethodGet, "/me/addresses", 2, nil)
+		var addresses []types.Address
+		json.NewDecoder(rr.Body).Decode(&addresses)
+		if len(addresses) != 0 {
+			t.Errorf("expected no addresses, got %+v", addresses)
+		}
+	})
+
+	t.Run("should delete the address", func(t *testing.T) {
+		if rr := serve(http.MethodDelete, "/me/addresses/2", 1, nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if rr := serve(http.MethodGet, "/me/addresses/2", 1, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+type mockAddressStore struct {
+	addresses []types.Address
+}
+
+func (m *mockAddressStore) CreateAddress(a types.Address) (int, error) {
+	a.ID = len(m.addresses) + 1
+	m.clearDefaults(a)
+	m.addresses = append(m.addresses, a)
+	return a.ID, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(id int) (*types.Address, error) {
+	for i := range m.addresses {
+		if m.addresses[i].ID == id {
+			a := m.addresses[i]
+			return &a, nil
+		}
+	}
+	return nil, fmt.Errorf("address not found")
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	addresses := make([]types.Address, 0)
+	for _, a := range m.addresses {
+		if a.UserID == userID {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(a types.Address) error {
+	m.clearDefaults(a)
+	for i := range m.addresses {
+		if m.addresses[i].ID == a.ID {
+			m.addresses[i] = a
+		}
+	}
+	return nil
+}
+
+func (m *mockAddressStore) DeleteAddress(id int) error {
+	for i := range m.addresses {
+		if m.addresses[i].ID == id {
+			m.addresses = append(m.addresses[:i], m.addresses[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockAddressStore) clearDefaults(a types.Address) {
+	for i := range m.addresses {
+		if m.addresses[i].UserID != a.UserID || m.addresses[i].ID == a.ID {
+			continue
+		}
+		if a.IsDefaultShipping {
+			m.addresses[i].IsDefaultShipping = false
+		}
+		if a.IsDefaultBilling {
+			m.addresses[i].IsDefaultBilling = false
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package address
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAddress(a types.Address) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := clearDefaults(tx, a); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO addresses (userId, name, line1, line2, city, region, postalCode, country, phone, isDefaultShipping, isDefaultBilling)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.UserID, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+func (s *Store) GetAddressByID(id int) (*types.Address, error) {
+	rows, err := s.db.Query("SELECT * FROM addresses WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	a := new(types.Address)
+	for rows.Next() {
+		a, err = scanRowIntoAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.ID == 0 {
+		return nil, fmt.Errorf("address not found")
+	}
+
+	return a, nil
+}
+
+// defaults first, then the newest
+func (s *Store) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	rows, err := s.db.Query("SELECT * FROM addresses WHERE userId = ? ORDER BY isDefaultShipping DESC, isDefaultBilling DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := make([]types.Address, 0)
+	for rows.Next() {
+		a, err := scanRowIntoAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	return addresses, nil
+}
+
+func (s *Store) UpdateAddress(a types.Address) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := clearDefaults(tx, a); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE addresses SET name = ?, line1 = ?, line2 = ?, city = ?, region = ?, postalCode = ?, country = ?, phone = ?,
+		isDefaultShipping = ?, isDefaultBilling = ? WHERE id = ?`,
+		a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling, a.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// orders keep their own copy, nothing else points to an address
+func (s *Store) DeleteAddress(id int) error {
+	_, err := s.db.Exec("DELETE FROM addresses WHERE id = ?", id)
+	return err
+}
+
+// a new default takes the flag from the user's other addresses
+func clearDefaults(tx *sql.Tx, a types.Address) error {
+	if a.IsDefaultShipping {
+		if _, err := tx.Exec("UPDATE addresses SET isDefaultShipping = FALSE WHERE userId = ? AND id != ?", a.UserID, a.ID); err != nil {
+			return err
+		}
+	}
+	if a.IsDefaultBilling {
+		if _, err := tx.Exec("UPDATE addresses SET isDefaultBilling = FALSE WHERE userId = ? AND id != ?", a.UserID, a.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanRowIntoAddress(rows *sql.Rows) (*types.Address, error) {
+	a := new(types.Address)
+	err := rows.Scan(
+		&a.ID,
+		&a.UserID,
+		&a.Name,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.PostalCode,
+		&a.Country,
+		&a.Phone,
+		&a.IsDefaultShipping,
+		&a.IsDefaultBilling,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
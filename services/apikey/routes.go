@@ -0,0 +1,132 @@
+package apikey
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store        types.APIKeyStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	auditStore   types.AuditStore
+}
+
+func NewHandler(store types.APIKeyStore, userStore types.UserStore, sessionStore types.SessionStore, auditStore types.AuditStore) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore, auditStore: auditStore}
+}
+
+// API keys are managed by admins only, and only with their own login (not with another key)
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/api-keys", auth.WithJWTAuth(auth.WithRole(h.handleCreateAPIKey, types.RoleAdmin), h.userStore, h.sessionStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/api-keys", auth.WithJWTAuth(auth.WithRole(h.handleGetAPIKeys, types.RoleAdmin), h.userStore, h.sessionStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/api-keys/{keyID}", auth.WithJWTAuth(auth.WithRole(h.handleRevokeAPIKey, types.RoleAdmin), h.userStore, h.sessionStore)).Methods(http.MethodDelete)
+}
+
+// the key is in the response once, it can't be looked up again
+func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload types.CreateAPIKeyPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expiresAt must be in the future"))
+		return
+	}
+
+	key, prefix, secretHash, err := auth.GenerateAPIKey()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	adminID := auth.GetUserIDFromContext(r.Context())
+	keyID, err := h.store.CreateAPIKey(types.APIKey{
+		Name:       payload.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     payload.Scopes,
+		CreatedBy:  adminID,
+		ExpiresAt:  payload.ExpiresAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	apiKey, err := h.store.GetAPIKeyByID(keyID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit(r, types.AuditActionAPIKeyCreated, apiKey, strings.Join(apiKey.Scopes, ","))
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]any{"apiKey": apiKey, "key": key})
+}
+
+func (h *Handler) handleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.GetAPIKeys()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, keys)
+}
+
+func (h *Handler) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.Atoi(mux.Vars(r)["keyID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid api key id"))
+		return
+	}
+
+	apiKey, err := h.store.GetAPIKeyByID(keyID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("api key with id %d not found", keyID))
+		return
+	}
+
+	if err := h.store.RevokeAPIKey(apiKey.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit(r, types.AuditActionAPIKeyRevoked, apiKey, "")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "api key revoked"})
+}
+
+func (h *Handler) audit(r *http.Request, action string, apiKey *types.APIKey, details string) {
+	err := h.auditStore.CreateAuditEntry(types.AuditEntry{
+		ActorID:    auth.GetUserIDFromContext(r.Context()),
+		Action:     action,
+		TargetType: "api_key",
+		TargetID:   strconv.Itoa(apiKey.ID),
+		Details:    details,
+		IP:         utils.ClientIP(r),
+	})
+	if err != nil {
+		log.Printf("failed to write audit entry for api key %d: %v", apiKey.ID, err)
+	}
+}
@@ -0,0 +1,111 @@
+package apikey
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAPIKey(key types.APIKey) (int, error) {
+	res, err := s.db.Exec("INSERT INTO api_keys (name, prefix, secretHash, scopes, createdBy, expiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		key.Name, key.Prefix, key.SecretHash, strings.Join(key.Scopes, ","), key.CreatedBy, key.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *Store) GetAPIKeyByID(id int) (*types.APIKey, error) {
+	return s.getAPIKey("SELECT * FROM api_keys WHERE id = ?", id)
+}
+
+func (s *Store) GetAPIKeyByPrefix(prefix string) (*types.APIKey, error) {
+	return s.getAPIKey("SELECT * FROM api_keys WHERE prefix = ?", prefix)
+}
+
+func (s *Store) getAPIKey(query string, args ...interface{}) (*types.APIKey, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	key := new(types.APIKey)
+	for rows.Next() {
+		key, err = scanRowIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key.ID == 0 {
+		return nil, fmt.Errorf("api key not found")
+	}
+
+	return key, nil
+}
+
+func (s *Store) GetAPIKeys() ([]types.APIKey, error) {
+	rows, err := s.db.Query("SELECT * FROM api_keys ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]types.APIKey, 0)
+	for rows.Next() {
+		key, err := scanRowIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(id int) error {
+	_, err := s.db.Exec("UPDATE api_keys SET revokedAt = now() WHERE id = ? AND revokedAt IS NULL", id)
+	return err
+}
+
+func (s *Store) TouchAPIKey(id int, usedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET lastUsedAt = ? WHERE id = ?", usedAt, id)
+	return err
+}
+
+func scanRowIntoAPIKey(rows *sql.Rows) (*types.APIKey, error) {
+	key := new(types.APIKey)
+	var scopes string
+	err := rows.Scan(&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.SecretHash,
+		&scopes,
+		&key.CreatedBy,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+
+	return key, nil
+}
@@ -0,0 +1,22 @@
+package audit
+
+import (
+	"database/sql"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateAuditEntry(entry types.AuditEntry) error {
+	actorID := sql.NullInt64{Int64: int64(entry.ActorID), Valid: entry.ActorID != 0}
+	_, err := s.db.Exec("INSERT INTO audit_log (actorId, action, targetType, targetId, details, ip) VALUES (?, ?, ?, ?, ?, ?)",
+		actorID, entry.Action, entry.TargetType, entry.TargetID, entry.Details, entry.IP)
+	return err
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+)
+
+const APIKeyKey contextKey = "apiKey"
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "ak"
+	// last used is only written again after this long, not on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+/* New API key in the form ak_<prefix>_<secret>.
+*	the prefix finds the key and can be shown in lists, only the hash of the secret is stored
+ */
+func GenerateAPIKey() (key, prefix, secretHash string, err error) {
+	prefix, err = GenerateRandomID(4)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	return fmt.Sprintf("%s_%s_%s", apiKeyPrefix, prefix, secret), prefix, HashToken(secret), nil
+}
+
+// split a key into its prefix and secret, the secret can contain underscores
+func parseAPIKey(key string) (string, string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+/* Authenticate the request with the X-API-Key header, or the access token without it.
+*	API keys act on their own, without a user or role in the context,
+*	so the route has to be wrapped by WithScopeOrRole to let them in
+ */
+func WithJWTOrAPIKey(handlerFunc http.HandlerFunc, store types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore) http.HandlerFunc {
+	withJWT := WithJWTAuth(handlerFunc, store, sessionStore)
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if key == "" {
+			withJWT(w, r)
+			return
+		}
+
+		apiKey, err := validateAPIKey(key, apiKeyStore)
+		if err != nil {
+			log.Printf("failed to validate API key: %v", err)
+			utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid API key"))
+			return
+		}
+
+		if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+			if err := apiKeyStore.TouchAPIKey(apiKey.ID, time.Now()); err != nil {
+				log.Printf("failed to update last use of API key %d: %v", apiKey.ID, err)
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), APIKeyKey, apiKey))
+		handlerFunc(w, r)
+	}
+}
+
+func validateAPIKey(key string, apiKeyStore types.APIKeyStore) (*types.APIKey, error) {
+	prefix, secret, ok := parseAPIKey(key)
+	if !ok {
+		return nil, fmt.Errorf("malformed key")
+	}
+	apiKey, err := apiKeyStore.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.SecretHash), []byte(HashToken(secret))) != 1 {
+		return nil, fmt.Errorf("wrong secret for key %s", prefix)
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("key %s is revoked", prefix)
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, fmt.Errorf("key %s expired", prefix)
+	}
+	return apiKey, nil
+}
+
+// API keys need the scope, users one of the roles (see WithRole)
+func WithScopeOrRole(handlerFunc http.HandlerFunc, scope string, roles ...string) http.HandlerFunc {
+	withRole := WithRole(handlerFunc, roles...)
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := GetAPIKeyFromContext(r.Context())
+		if apiKey == nil {
+			withRole(w, r)
+			return
+		}
+		if !apiKey.HasScope(scope) {
+			log.Printf("API key %s is missing scope %q", apiKey.Prefix, scope)
+			permissionDenied(w)
+			return
+		}
+		handlerFunc(w, r)
+	}
+}
+
+func GetAPIKeyFromContext(ctx context.Context) *types.APIKey {
+	apiKey, ok := ctx.Value(APIKeyKey).(*types.APIKey)
+	if !ok {
+		return nil
+	}
+	return apiKey
+}
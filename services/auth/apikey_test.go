@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestWithJWTOrAPIKey(t *testing.T) {
+	store := &mockAPIKeyStore{}
+	key := store.add(t, []string{types.ScopeOrdersRead}, nil)
+	writeKey := store.add(t, []string{types.ScopeOrdersWrite}, nil)
+	expired := time.Now().Add(-time.Minute)
+	expiredKey := store.add(t, []string{types.ScopeOrdersRead}, &expired)
+	revokedKey := store.add(t, []string{types.ScopeOrdersRead}, nil)
+	now := time.Now()
+	store.keys[3].RevokedAt = &now
+
+	handler := WithJWTOrAPIKey(WithScopeOrRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, types.ScopeOrdersRead, types.RoleStaff), &mockUserStore{}, &mockSessionStore{}, store)
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	t.Run("should accept a key with the scope and track its use", func(t *testing.T) {
+		if rr := serve("X-API-Key", key); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.keys[0].LastUsedAt == nil {
+			t.Errorf("expected last used to be set")
+		}
+	})
+
+	t.Run("should forbid a key without the scope", func(t *testing.T) {
+		if rr := serve("X-API-Key", writeKey); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	cases := map[string]string{
+		"expired":      expiredKey,
+		"revoked":      revokedKey,
+		"wrong secret": key + "x",
+		"malformed":    "not-a-key",
+		"unknown":      "ak_00000000_secret",
+	}
+	for name, value := range cases {
+		t.Run("should reject a "+name+" key", func(t *testing.T) {
+			if rr := serve("X-API-Key", value); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should fall back to the access token", func(t *testing.T) {
+		if rr := serve("", ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+		// a valid login, but without the staff role
+		token, _ := CreateJWT(&types.User{ID: 1}, "active")
+		if rr := serve("Authorization", "Bearer "+token); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestWithRoleRejectsAPIKeys(t *testing.T) {
+	store := &mockAPIKeyStore{}
+	key := store.add(t, []string{types.ScopeProductsWrite, types.ScopeOrdersRead, types.ScopeOrdersWrite}, nil)
+
+	handler := WithJWTOrAPIKey(WithRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, types.RoleStaff, types.RoleAdmin), &mockUserStore{}, &mockSessionStore{}, store)
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+type mockAPIKeyStore struct {
+	types.APIKeyStore
+	keys []types.APIKey
+}
+
+func (m *mockAPIKeyStore) add(t *testing.T, scopes []string, expiresAt *time.Time) string {
+	key, prefix, secretHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.keys = append(m.keys, types.APIKey{ID: len(m.keys) + 1, Prefix: prefix, SecretHash: secretHash, Scopes: scopes, ExpiresAt: expiresAt})
+	return key
+}
+
+func (m *mockAPIKeyStore) GetAPIKeyByPrefix(prefix string) (*types.APIKey, error) {
+	for i := range m.keys {
+		if m.keys[i].Prefix == prefix {
+			key := m.keys[i]
+			return &key, nil
+		}
+	}
+	return nil, fmt.Errorf("api key not found")
+}
+
+func (m *mockAPIKeyStore) TouchAPIKey(id int, usedAt time.Time) error {
+	m.keys[id-1].LastUsedAt = &usedAt
+	return nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// first bytes of a breached password file
+const breachedPasswordsMagic = "GOBF1"
+
+/* Bloom filter of breached passwords, keyed by their SHA-1 like the public breach corpora.
+*	the filter never has false negatives, a false positive only asks an unlucky user for another
+*	password. a few million passwords fit in a few MB (~1.8 bytes each at 0.1%) and no password
+*	or hash can be read back from it, so it can ship with the server and work offline
+ */
+type BreachedPasswords struct {
+	m    uint64 // bits
+	k    uint32 // hash functions
+	bits []byte
+}
+
+// empty filter sized for n passwords at the given false positive rate
+func NewBreachedPasswords(n int, falsePositiveRate float64) *BreachedPasswords {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BreachedPasswords{m: m, k: k, bits: make([]byte, (m+7)/8)}
+}
+
+func (b *BreachedPasswords) Add(password string) {
+	b.AddSHA1(sha1.Sum([]byte(password)))
+}
+
+// for building the filter straight from a list of SHA-1 hashes
+func (b *BreachedPasswords) AddSHA1(digest [sha1.Size]byte) {
+	for _, i := range b.indexes(digest) {
+		b.bits[i/8] |= 1 << (i % 8)
+	}
+}
+
+func (b *BreachedPasswords) Contains(password string) bool {
+	for _, i := range b.indexes(sha1.Sum([]byte(password))) {
+		if b.bits[i/8]&(1<<(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// double hashing, the digest is already uniform so its halves are used as the two hashes
+func (b *BreachedPasswords) indexes(digest [sha1.Size]byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	indexes := make([]uint64, b.k)
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) % b.m
+	}
+	return indexes
+}
+
+// magic, k (uint32), m (uint64), then the bits
+func (b *BreachedPasswords) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(breachedPasswordsMagic)+12)
+	copy(header, breachedPasswordsMagic)
+	binary.BigEndian.PutUint32(header[len(breachedPasswordsMagic):], b.k)
+	binary.BigEndian.PutUint64(header[len(breachedPasswordsMagic)+4:], b.m)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	written, err := w.Write(b.bits)
+	return int64(n + written), err
+}
+
+func ReadBreachedPasswords(r io.Reader) (*BreachedPasswords, error) {
+	header := make([]byte, len(breachedPasswordsMagic)+12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("invalid breached password file: %v", err)
+	}
+	if string(header[:len(breachedPasswordsMagic)]) != breachedPasswordsMagic {
+		return nil, fmt.Errorf("invalid breached password file: unknown format")
+	}
+
+	b := &BreachedPasswords{
+		k: binary.BigEndian.Uint32(header[len(breachedPasswordsMagic):]),
+		m: binary.BigEndian.Uint64(header[len(breachedPasswordsMagic)+4:]),
+	}
+	if b.k == 0 || b.m == 0 {
+		return nil, fmt.Errorf("invalid breached password file: empty filter")
+	}
+	b.bits = make([]byte, (b.m+7)/8)
+	if _, err := io.ReadFull(r, b.bits); err != nil {
+		return nil, fmt.Errorf("invalid breached password file: %v", err)
+	}
+	return b, nil
+}
+
+// turn on the breached password check of the policy, nothing to do without a file
+func LoadBreachedPasswords(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := ReadBreachedPasswords(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", file, err)
+	}
+	passwordPolicy.Breached = b
+	return nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const twoFactorChallengeAudience = "2fa-challenge"
+
+/* Short lived token returned by login when the user has 2FA enabled.
+*	proves the password was right, and is exchanged for the real tokens together with a TOTP code
+ */
+func CreateTwoFactorChallenge(user *types.User) (string, error) {
+	expiration := time.Duration(config.Envs.TwoFactorChallengeExpirationInSeconds) * time.Second
+
+	tokenID, err := GenerateRandomID(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return currentKeys().sign(jwt.RegisteredClaims{
+		Issuer:    config.Envs.JWTIssuer,
+		Subject:   strconv.Itoa(user.ID),
+		Audience:  jwt.ClaimStrings{twoFactorChallengeAudience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        tokenID,
+	})
+}
+
+// returns the ID of the user who passed the password step
+func ValidateTwoFactorChallenge(tokenString string) (int, error) {
+	claims := new(jwt.RegisteredClaims)
+	if err := parseClaims(tokenString, claims, twoFactorChallengeAudience); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(claims.Subject)
+}
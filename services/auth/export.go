@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const dataExportAudience = "data-export"
+
+type DataExportClaims struct {
+	jwt.RegisteredClaims
+	ExportID int `json:"exportID"`
+}
+
+// signed download link of a data export, valid until the file is deleted
+func CreateDataExportToken(export *types.DataExport) (string, error) {
+	return currentKeys().sign(DataExportClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   strconv.Itoa(export.UserID),
+			Audience:  jwt.ClaimStrings{dataExportAudience},
+			ExpiresAt: jwt.NewNumericDate(*export.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		ExportID: export.ID,
+	})
+}
+
+func ValidateDataExportToken(tokenString string) (*DataExportClaims, error) {
+	claims := new(DataExportClaims)
+	if err := parseClaims(tokenString, claims, dataExportAudience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
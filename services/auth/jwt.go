@@ -2,10 +2,12 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/faldeus0092/go-ecom/config"
@@ -17,78 +19,173 @@ import (
 type contextKey string
 
 const UserKey contextKey = "userID"
+const SessionKey contextKey = "sessionID"
+const RoleKey contextKey = "role"
+const TwoFactorKey contextKey = "twoFactor"
+
+// access token claims. sub holds the user ID, sid the session (refresh token family)
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid"`
+	Role      string `json:"role"`
+	// set when an admin acts as the user, see CreateImpersonationJWT
+	Act *ActorClaim `json:"act,omitempty"`
+}
 
-func CreateJWT(secret []byte, userID int) (string, error) {
+func CreateJWT(user *types.User, sessionID string) (string, error) {
 	expiration := time.Duration(config.Envs.JWTExpirationInSeconds)*time.Second
-	
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": strconv.Itoa(userID),
-		"expiredAt": time.Now().Add(expiration).Unix(),
-	})
+	return createAccessToken(user, sessionID, time.Now().Add(expiration), nil)
+}
 
-	tokenString, err := token.SignedString(secret)
+func createAccessToken(user *types.User, sessionID string, expiresAt time.Time, act *ActorClaim) (string, error) {
+	tokenID, err := GenerateRandomID(16)
 	if err != nil {
 		return "", err
 	}
-	return tokenString, nil
+
+	now := time.Now()
+	return currentKeys().sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{config.Envs.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        tokenID,
+		},
+		SessionID: sessionID,
+		Role:      user.Role,
+		Act:       act,
+	})
 }
 
-func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
+/* Authenticate the request with the access token.
+*	401 means we couldn't tell who the caller is (missing, malformed, expired or revoked token, unknown user),
+*	403 is left for callers we know but that aren't allowed to do something
+ */
+func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore, sessionStore types.SessionStore) http.HandlerFunc {
 	return func (w http.ResponseWriter, r *http.Request)  {
 		// get token from user request
 		tokenString := getTokenFromRequest(r)
+		if tokenString == "" {
+			unauthorized(w, "missing token")
+			return
+		}
 
 		// validate the JWT
-		token, err := validateToken(tokenString)
+		claims, err := validateToken(tokenString)
 		if err != nil {
 			log.Printf("failed to validate token: %v", err)
-			permissionDenied(w)
-			return
-		}
-		
-		if !token.Valid{
-			log.Printf("token invalid")
-			permissionDenied(w)
+			switch {
+			case errors.Is(err, jwt.ErrTokenExpired):
+				unauthorized(w, "token expired")
+			case errors.Is(err, jwt.ErrTokenMalformed):
+				unauthorized(w, "malformed token")
+			default:
+				unauthorized(w, "invalid token")
+			}
 			return
 		}
 
 		// fetch the userID from DB using the token
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userID"].(string)
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			log.Printf("invalid subject %q: %v", claims.Subject, err)
+			unauthorized(w, "invalid token")
+			return
+		}
 
-		userID, _ := strconv.Atoi(str)
+		// reject tokens whose session was logged out or revoked
+		if claims.SessionID == "" {
+			log.Printf("token has no session")
+			unauthorized(w, "invalid token")
+			return
+		}
+		active, err := sessionStore.IsSessionActive(claims.SessionID)
+		if err != nil || !active {
+			log.Printf("session %s is not active: %v", claims.SessionID, err)
+			unauthorized(w, "session revoked")
+			return
+		}
 
 		u, err := store.GetUserByID(userID)
 		if err != nil {
 			log.Printf("failed to get user with id: %v", err)
-			permissionDenied(w)
+			unauthorized(w, "unknown user")
+			return
+		}
+		// checked on every request, a suspension applies to tokens already out there
+		if u.SuspendedAt != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("account suspended"))
 			return
 		}
 
+		// every request made as someone else has to end up in the audit log
+		var actorID int
+		if claims.Act != nil {
+			if actorID, err = checkImpersonation(r, claims.Act, u, store); err != nil {
+				log.Printf("impersonation of user %d refused: %v", u.ID, err)
+				utils.WriteError(w, http.StatusForbidden, fmt.Errorf("impersonation refused"))
+				return
+			}
+		}
+
+		touchSession(sessionStore, claims.SessionID)
+
 		// change request context "userID"
 		ctx := r.Context()
+		if actorID != 0 {
+			ctx = context.WithValue(ctx, ActorKey, actorID)
+		}
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, SessionKey, claims.SessionID)
+		// the role claim is only informative, use the one in DB so a demotion applies right away
+		ctx = context.WithValue(ctx, RoleKey, u.Role)
+		ctx = context.WithValue(ctx, TwoFactorKey, u.TOTPEnabledAt != nil)
 		r = r.WithContext(ctx)
 		handlerFunc(w, r)
 	}
 }
 
+// accepts both "Bearer <token>" and the bare token
 func getTokenFromRequest(r *http.Request) string {
 	tokenAuth := r.Header.Get("Authorization")
 	if tokenAuth != "" {
+		if len(tokenAuth) > 7 && strings.EqualFold(tokenAuth[:7], "bearer ") {
+			return strings.TrimSpace(tokenAuth[7:])
+		}
 		return tokenAuth
 	}
 	return ""
 }
 
-func validateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok{
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		// secretkey
-		return []byte(config.Envs.JWTSecret), nil
-	})
+// parse the token and enforce exp, nbf, iat, iss and aud
+func validateToken(tokenString string) (*Claims, error) {
+	claims := new(Claims)
+	if err := parseClaims(tokenString, claims, config.Envs.JWTAudience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// every token we sign is checked the same way, only the audience tells them apart
+func parseClaims(tokenString string, claims jwt.Claims, audience string) error {
+	ks := currentKeys()
+	_, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithValidMethods(ks.validMethods()),
+		jwt.WithIssuer(config.Envs.JWTIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(time.Duration(config.Envs.JWTClockSkewInSeconds)*time.Second),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	return err
+}
+
+func unauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, reason))
+	utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("%s", reason))
 }
 
 func permissionDenied(w http.ResponseWriter)  {
@@ -101,4 +198,20 @@ func GetUserIDFromContext(ctx context.Context) int {
 		return -1
 	}
 	return userID
-}
\ No newline at end of file
+}
+
+func GetRoleFromContext(ctx context.Context) string {
+	role, ok := ctx.Value(RoleKey).(string)
+	if !ok {
+		return ""
+	}
+	return role
+}
+
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, ok := ctx.Value(SessionKey).(string)
+	if !ok {
+		return ""
+	}
+	return sessionID
+}
@@ -1,14 +1,291 @@
 package auth
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/golang-jwt/jwt/v5"
+)
 
 func TestCreateJWT(t *testing.T) {
-	secret := []byte("this-is-a-secret")
-	token, err := CreateJWT(secret, 1)
+	token, err := CreateJWT(&types.User{ID: 1}, "session")
 	if err != nil {
 		t.Errorf("error creating JWT: %v", err)
 	}
 	if token == ""{
 		t.Errorf("expected token to not empty")
 	}
-}
\ No newline at end of file
+}
+
+func TestValidateToken(t *testing.T) {
+	t.Run("should accept a token created by CreateJWT", func(t *testing.T) {
+		token, err := CreateJWT(&types.User{ID: 42}, "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := validateToken(token)
+		if err != nil {
+			t.Fatalf("expected token to be valid, got %v", err)
+		}
+		if claims.Subject != "42" || claims.SessionID != "session" || claims.ID == "" {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		claims := testClaims()
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		_, err := validateToken(signTestClaims(t, claims))
+		if !errors.Is(err, jwt.ErrTokenExpired) {
+			t.Errorf("expected expired error, got %v", err)
+		}
+	})
+
+	t.Run("should reject a token without exp", func(t *testing.T) {
+		claims := testClaims()
+		claims.ExpiresAt = nil
+		if _, err := validateToken(signTestClaims(t, claims)); err == nil {
+			t.Errorf("expected token without exp to be rejected")
+		}
+	})
+
+	t.Run("should reject a token not valid yet", func(t *testing.T) {
+		claims := testClaims()
+		claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		_, err := validateToken(signTestClaims(t, claims))
+		if !errors.Is(err, jwt.ErrTokenNotValidYet) {
+			t.Errorf("expected not valid yet error, got %v", err)
+		}
+	})
+
+	t.Run("should reject a token for another audience", func(t *testing.T) {
+		claims := testClaims()
+		claims.Audience = jwt.ClaimStrings{"another-api"}
+		_, err := validateToken(signTestClaims(t, claims))
+		if !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+			t.Errorf("expected invalid audience error, got %v", err)
+		}
+	})
+
+	t.Run("should reject a token from another issuer", func(t *testing.T) {
+		claims := testClaims()
+		claims.Issuer = "someone-else"
+		_, err := validateToken(signTestClaims(t, claims))
+		if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+			t.Errorf("expected invalid issuer error, got %v", err)
+		}
+	})
+
+	t.Run("should tolerate the configured clock skew", func(t *testing.T) {
+		claims := testClaims()
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second))
+		if _, err := validateToken(signTestClaims(t, claims)); err != nil {
+			t.Errorf("expected token within clock skew to be valid, got %v", err)
+		}
+	})
+}
+
+func TestWithJWTAuth(t *testing.T) {
+	handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, &mockUserStore{}, &mockSessionStore{})
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	t.Run("should accept a valid token", func(t *testing.T) {
+		token, _ := CreateJWT(&types.User{ID: 1}, "active")
+		if rr := serve(token); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should refuse a suspended user", func(t *testing.T) {
+		token, _ := CreateJWT(&types.User{ID: 2}, "active")
+		if rr := serve(token); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	cases := map[string]func() string{
+		"missing": func() string { return "" },
+		"malformed": func() string { return "not-a-jwt" },
+		"expired": func() string {
+			claims := testClaims()
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return signTestClaims(t, claims)
+		},
+		"revoked session": func() string {
+			token, _ := CreateJWT(&types.User{ID: 1}, "revoked")
+			return token
+		},
+		"unknown user": func() string {
+			token, _ := CreateJWT(&types.User{ID: 404}, "active")
+			return token
+		},
+	}
+	for name, token := range cases {
+		t.Run("should return 401 for "+name+" token", func(t *testing.T) {
+			rr := serve(token())
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+			if rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	handler := WithJWTAuth(WithoutImpersonation(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), &mockUserStore{}, &mockSessionStore{})
+	actorHandler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		if GetUserIDFromContext(r.Context()) != 1 || GetActorIDFromContext(r.Context()) != 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}, &mockUserStore{}, &mockSessionStore{})
+
+	serve := func(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/cart", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	expiresAt := time.Now().Add(time.Minute)
+
+	t.Run("should refuse impersonation tokens until it's enabled", func(t *testing.T) {
+		EnableImpersonation(nil)
+		token, _ := CreateImpersonationJWT(&types.User{ID: 1}, "active", 3, expiresAt)
+		if rr := serve(actorHandler, token); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	auditStore := &mockAuditStore{}
+	EnableImpersonation(auditStore)
+	defer EnableImpersonation(nil)
+
+	t.Run("should pass the actor and audit the request", func(t *testing.T) {
+		token, _ := CreateImpersonationJWT(&types.User{ID: 1}, "active", 3, expiresAt)
+		if rr := serve(actorHandler, token); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if len(auditStore.entries) != 1 {
+			t.Fatalf("expected 1 audit entry, got %d", len(auditStore.entries))
+		}
+		entry := auditStore.entries[0]
+		if entry.ActorID != 3 || entry.TargetID != "1" || entry.Action != types.AuditActionImpersonatedRequest || entry.Details != "GET /cart" {
+			t.Errorf("unexpected audit entry %+v", entry)
+		}
+	})
+
+	t.Run("should refuse an actor that isn't an admin", func(t *testing.T) {
+		token, _ := CreateImpersonationJWT(&types.User{ID: 1}, "active", 2, expiresAt)
+		if rr := serve(actorHandler, token); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should block routes the user has to use themselves", func(t *testing.T) {
+		token, _ := CreateImpersonationJWT(&types.User{ID: 1}, "active", 3, expiresAt)
+		if rr := serve(handler, token); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		token, _ = CreateJWT(&types.User{ID: 1}, "active")
+		if rr := serve(handler, token); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d for the user's own token, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func testClaims() Claims {
+	now := time.Now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   "1",
+			Audience:  jwt.ClaimStrings{config.Envs.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "test",
+		},
+		SessionID: "active",
+	}
+}
+
+func signTestClaims(t *testing.T, claims Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Envs.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// only implements what WithJWTAuth uses, the embedded interface panics on anything else
+type mockUserStore struct {
+	types.UserStore
+}
+
+// user 2 is suspended, user 3 is an admin
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	switch id {
+	case 1:
+		return &types.User{ID: 1}, nil
+	case 2:
+		suspendedAt := time.Now()
+		return &types.User{ID: 2, SuspendedAt: &suspendedAt}, nil
+	case 3:
+		return &types.User{ID: 3, Role: types.RoleAdmin}, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// only the "active" session is active
+type mockSessionStore struct {
+	types.SessionStore
+	touched int
+}
+
+func (m *mockSessionStore) IsSessionActive(sessionID string) (bool, error) {
+	return sessionID == "active", nil
+}
+
+func (m *mockSessionStore) TouchSession(sessionID string, lastSeenAt time.Time) error {
+	m.touched++
+	return nil
+}
+
+type mockAuditStore struct {
+	entries []types.AuditEntry
+}
+
+func (m *mockAuditStore) CreateAuditEntry(entry types.AuditEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/* KeySet holds the key access tokens are signed with and every key they can be verified with.
+*	with no key files configured it falls back to HS256 with config.Envs.JWTSecret.
+*	keys are identified by their RFC 7638 thumbprint, which goes into the "kid" header
+ */
+type KeySet struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	verification  map[string]verificationKey
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   = newHMACKeySet([]byte(config.Envs.JWTSecret))
+)
+
+func newHMACKeySet(secret []byte) *KeySet {
+	return &KeySet{
+		signingMethod: jwt.SigningMethodHS256,
+		signingKey:    secret,
+		verification:  map[string]verificationKey{},
+	}
+}
+
+/* Load the signing key and the verification keys, then swap them in.
+*	every *.pem in verificationKeysDir is accepted for verification, the public part of the
+*	signing key always is. rotating without downtime is:
+*	1. drop the new public key in the dir and reload, every instance now accepts it
+*	2. point the signing key to the new private key and reload
+*	3. once the old access tokens expired, remove the old public key and reload
+ */
+func LoadKeys(signingKeyFile, verificationKeysDir string) error {
+	if signingKeyFile == "" {
+		setKeys(newHMACKeySet([]byte(config.Envs.JWTSecret)))
+		return nil
+	}
+
+	ks := &KeySet{verification: map[string]verificationKey{}}
+
+	signer, err := readPrivateKey(signingKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key %s: %v", signingKeyFile, err)
+	}
+	vk, kid, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return fmt.Errorf("failed to load signing key %s: %v", signingKeyFile, err)
+	}
+	ks.signingKID = kid
+	ks.signingMethod = vk.method
+	ks.signingKey = signer
+	ks.verification[kid] = vk
+
+	if verificationKeysDir != "" {
+		files, err := filepath.Glob(filepath.Join(verificationKeysDir, "*.pem"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			public, err := readPublicKey(file)
+			if err != nil {
+				return fmt.Errorf("failed to load verification key %s: %v", file, err)
+			}
+			vk, kid, err := newVerificationKey(public)
+			if err != nil {
+				return fmt.Errorf("failed to load verification key %s: %v", file, err)
+			}
+			ks.verification[kid] = vk
+		}
+	}
+
+	setKeys(ks)
+	log.Printf("JWT keys loaded, signing with %s key %s, %d verification key(s)", ks.signingMethod.Alg(), ks.signingKID, len(ks.verification))
+	return nil
+}
+
+func setKeys(ks *KeySet) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = ks
+}
+
+func currentKeys() *KeySet {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys
+}
+
+func (ks *KeySet) isHMAC() bool {
+	_, ok := ks.signingKey.([]byte)
+	return ok
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	if ks.signingKID != "" {
+		token.Header["kid"] = ks.signingKID
+	}
+	return token.SignedString(ks.signingKey)
+}
+
+// the algorithms accepted when parsing, never mixes HMAC with public keys
+func (ks *KeySet) validMethods() []string {
+	if ks.isHMAC() {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	if ks.isHMAC() {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		// secretkey
+		return ks.signingKey, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	vk, ok := ks.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %s", t.Header["alg"], kid)
+	}
+	return vk.key, nil
+}
+
+func newVerificationKey(public crypto.PublicKey) (verificationKey, string, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return verificationKey{}, "", fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		vk := verificationKey{method: jwt.SigningMethodRS256, key: key}
+		return vk, thumbprint(vk), nil
+	case ed25519.PublicKey:
+		vk := verificationKey{method: jwt.SigningMethodEdDSA, key: key}
+		return vk, thumbprint(vk), nil
+	default:
+		return verificationKey{}, "", fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+}
+
+func readPrivateKey(file string) (crypto.Signer, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// accepts a public key, or a private key whose public part is used
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PUBLIC KEY" {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	signer, err := readPrivateKey(file)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return block, nil
+}
+
+// JSON Web Key, only the public members
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (vk verificationKey) jwk(kid string) JWK {
+	switch key := vk.key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: vk.method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	default:
+		return JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: vk.method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(vk.key.(ed25519.PublicKey)),
+		}
+	}
+}
+
+// RFC 7638, hash of the required members in lexicographic order
+func thumbprint(vk verificationKey) string {
+	jwk := vk.jwk("")
+	var canonical string
+	if jwk.Kty == "RSA" {
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// the public keys other services need to verify our access tokens on their own
+func (ks *KeySet) JWKS() map[string][]JWK {
+	kids := make([]string, 0, len(ks.verification))
+	for kid := range ks.verification {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		jwks = append(jwks, ks.verification[kid].jwk(kid))
+	}
+	return map[string][]JWK{"keys": jwks}
+}
+
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, currentKeys().JWKS())
+}
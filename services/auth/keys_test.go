@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestLoadKeys(t *testing.T) {
+	// go back to HMAC for the other tests
+	t.Cleanup(func() { LoadKeys("", "") })
+
+	dir := t.TempDir()
+	verifyDir := filepath.Join(dir, "verify")
+	os.Mkdir(verifyDir, 0700)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := writePrivateKey(t, dir, "rsa.key", rsaKey)
+	edFile := writePrivateKey(t, dir, "ed25519.key", edKey)
+
+	t.Run("should sign with RS256 and a kid", func(t *testing.T) {
+		if err := LoadKeys(rsaFile, ""); err != nil {
+			t.Fatal(err)
+		}
+		token, err := CreateJWT(&types.User{ID: 1}, "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := validateToken(token); err != nil {
+			t.Errorf("expected token to be valid, got %v", err)
+		}
+		if alg, kid := tokenHeader(t, token); alg != "RS256" || kid == "" {
+			t.Errorf("expected RS256 with a kid, got %s %q", alg, kid)
+		}
+	})
+
+	t.Run("should keep accepting tokens of the old key after rotation", func(t *testing.T) {
+		if err := LoadKeys(rsaFile, ""); err != nil {
+			t.Fatal(err)
+		}
+		oldToken, _ := CreateJWT(&types.User{ID: 1}, "session")
+
+		// 1. publish the old public key, 2. sign with the new key
+		writePublicKey(t, verifyDir, "old.pem", rsaKey.Public())
+		if err := LoadKeys(edFile, verifyDir); err != nil {
+			t.Fatal(err)
+		}
+		newToken, _ := CreateJWT(&types.User{ID: 1}, "session")
+		if alg, _ := tokenHeader(t, newToken); alg != "EdDSA" {
+			t.Errorf("expected EdDSA, got %s", alg)
+		}
+		if _, err := validateToken(oldToken); err != nil {
+			t.Errorf("expected old token to be valid, got %v", err)
+		}
+		if _, err := validateToken(newToken); err != nil {
+			t.Errorf("expected new token to be valid, got %v", err)
+		}
+
+		// 3. retire the old key
+		os.Remove(filepath.Join(verifyDir, "old.pem"))
+		if err := LoadKeys(edFile, verifyDir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := validateToken(oldToken); err == nil {
+			t.Errorf("expected old token to be rejected once the key is retired")
+		}
+	})
+
+	t.Run("should reject HMAC tokens when using public keys", func(t *testing.T) {
+		if err := LoadKeys(edFile, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := validateToken(signTestClaims(t, testClaims())); err == nil {
+			t.Errorf("expected HS256 token to be rejected")
+		}
+	})
+
+	t.Run("should fail to load a broken key", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken.key")
+		os.WriteFile(broken, []byte("not a key"), 0600)
+		if err := LoadKeys(broken, ""); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("should publish every verification key in the JWKS", func(t *testing.T) {
+		writePublicKey(t, verifyDir, "rsa.pem", rsaKey.Public())
+		if err := LoadKeys(edFile, verifyDir); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		HandleJWKS(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var jwks struct {
+			Keys []JWK `json:"keys"`
+		}
+		json.NewDecoder(rr.Body).Decode(&jwks)
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+		}
+		kty := map[string]bool{}
+		for _, key := range jwks.Keys {
+			kty[key.Kty] = true
+			if key.Kid == "" || key.Use != "sig" {
+				t.Errorf("unexpected key %+v", key)
+			}
+		}
+		if !kty["RSA"] || !kty["OKP"] {
+			t.Errorf("expected an RSA and an OKP key, got %v", kty)
+		}
+	})
+
+	t.Run("should fall back to HMAC without a signing key", func(t *testing.T) {
+		if err := LoadKeys("", ""); err != nil {
+			t.Fatal(err)
+		}
+		if !currentKeys().isHMAC() || string(currentKeys().signingKey.([]byte)) != config.Envs.JWTSecret {
+			t.Errorf("expected HMAC keys")
+		}
+	})
+}
+
+func tokenHeader(t *testing.T, token string) (string, string) {
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(raw, &header)
+	return header.Alg, header.Kid
+}
+
+func writePrivateKey(t *testing.T, dir, name string, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func writePublicKey(t *testing.T, dir, name string, key crypto.PublicKey) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
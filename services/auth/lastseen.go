@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+// how stale the last seen of a session may get, it's only written once per interval
+const lastSeenInterval = 5 * time.Minute
+
+/* Remembers when the last seen of each session was written, so WithJWTAuth
+*	only hits the DB once per lastSeenInterval per session instead of on every request.
+*	per process, with several instances each writes at most once per interval
+ */
+type lastSeenTracker struct {
+	mu      sync.Mutex
+	written map[string]time.Time
+}
+
+var lastSeen = &lastSeenTracker{written: make(map[string]time.Time)}
+
+// whether the session is due for a write, and if so mark it written
+func (t *lastSeenTracker) due(sessionID string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if written, ok := t.written[sessionID]; ok && now.Sub(written) < lastSeenInterval {
+		return false
+	}
+	t.written[sessionID] = now
+
+	// forget sessions that went quiet
+	if len(t.written) > 10000 {
+		for id, written := range t.written {
+			if now.Sub(written) >= lastSeenInterval {
+				delete(t.written, id)
+			}
+		}
+	}
+	return true
+}
+
+func touchSession(sessionStore types.SessionStore, sessionID string) {
+	now := time.Now()
+	if !lastSeen.due(sessionID, now) {
+		return
+	}
+	if err := sessionStore.TouchSession(sessionID, now); err != nil {
+		log.Printf("failed to update last seen of session %s: %v", sessionID, err)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestLastSeenTracker(t *testing.T) {
+	tracker := &lastSeenTracker{written: make(map[string]time.Time)}
+	now := time.Now()
+
+	if !tracker.due("session", now) {
+		t.Errorf("expected the first request to be due")
+	}
+	if tracker.due("session", now.Add(lastSeenInterval-time.Second)) {
+		t.Errorf("expected no write within the interval")
+	}
+	if !tracker.due("other", now) {
+		t.Errorf("expected other sessions to be due")
+	}
+	if !tracker.due("session", now.Add(lastSeenInterval)) {
+		t.Errorf("expected a write once the interval passed")
+	}
+}
+
+func TestWithJWTAuthTouchesSession(t *testing.T) {
+	lastSeen = &lastSeenTracker{written: make(map[string]time.Time)}
+	sessionStore := &mockSessionStore{}
+	handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {}, &mockUserStore{}, sessionStore)
+
+	token, _ := CreateJWT(&types.User{ID: 1}, "active")
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler(httptest.NewRecorder(), req)
+	}
+
+	if sessionStore.touched != 1 {
+		t.Errorf("expected last seen to be written once, got %d", sessionStore.touched)
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// the delay after the first failure past the free ones
+const baseLoginDelay = time.Second
+
+/* MemoryLoginLimiter implements types.LoginLimiter inside the process.
+*	after freeFailures failures each attempt has to wait twice as long as the previous one,
+*	after maxFailures the key is locked out for lockout. a key is forgotten once it had no failure
+*	for lockout. state is lost on restart and not shared between instances, use a shared store for that
+ */
+type MemoryLoginLimiter struct {
+	mu           sync.Mutex
+	entries      map[string]*limiterEntry
+	freeFailures int
+	maxFailures  int
+	lockout      time.Duration
+	now          func() time.Time
+}
+
+type limiterEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewMemoryLoginLimiter(freeFailures, maxFailures int, lockout time.Duration) *MemoryLoginLimiter {
+	return &MemoryLoginLimiter{
+		entries:      make(map[string]*limiterEntry),
+		freeFailures: freeFailures,
+		maxFailures:  maxFailures,
+		lockout:      lockout,
+		now:          time.Now,
+	}
+}
+
+// how long the key has to wait before its next attempt, 0 when it can try now
+func (l *MemoryLoginLimiter) Check(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wait(key, l.now())
+}
+
+// record a failed attempt, returns how long the key has to wait now
+func (l *MemoryLoginLimiter) Fail(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	entry := l.entry(key, now)
+	if entry == nil {
+		entry = &limiterEntry{}
+		l.entries[key] = entry
+		l.prune(now)
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures >= l.maxFailures {
+		entry.lockedUntil = now.Add(l.lockout)
+	}
+	return l.wait(key, now)
+}
+
+// forget the failures of the key, after a successful login or when an admin unlocks it
+func (l *MemoryLoginLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+func (l *MemoryLoginLimiter) wait(key string, now time.Time) time.Duration {
+	entry := l.entry(key, now)
+	if entry == nil {
+		return 0
+	}
+	if now.Before(entry.lockedUntil) {
+		return entry.lockedUntil.Sub(now)
+	}
+	if entry.failures < l.freeFailures {
+		return 0
+	}
+
+	delay := baseLoginDelay << (entry.failures - l.freeFailures)
+	if delay <= 0 || delay > l.lockout {
+		delay = l.lockout
+	}
+	if next := entry.lastFailure.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// the entry of the key, nil if it has none or it expired
+func (l *MemoryLoginLimiter) entry(key string, now time.Time) *limiterEntry {
+	entry, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if l.expired(entry, now) {
+		delete(l.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (l *MemoryLoginLimiter) expired(entry *limiterEntry, now time.Time) bool {
+	return !now.Before(entry.lockedUntil) && now.Sub(entry.lastFailure) > l.lockout
+}
+
+// keep the map from growing forever when many keys fail once and never come back
+func (l *MemoryLoginLimiter) prune(now time.Time) {
+	if len(l.entries) < 10000 {
+		return
+	}
+	for key, entry := range l.entries {
+		if l.expired(entry, now) {
+			delete(l.entries, key)
+		}
+	}
+}
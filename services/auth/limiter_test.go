@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLoginLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewMemoryLoginLimiter(3, 6, 15*time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	t.Run("should allow the free attempts", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if wait := limiter.Fail("user"); wait != 0 {
+				t.Fatalf("expected no wait after %d failures, got %v", i+1, wait)
+			}
+		}
+	})
+
+	t.Run("should back off exponentially", func(t *testing.T) {
+		for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+			if wait := limiter.Fail("user"); wait != expected {
+				t.Fatalf("expected to wait %v, got %v", expected, wait)
+			}
+			now = now.Add(expected)
+			if wait := limiter.Check("user"); wait != 0 {
+				t.Fatalf("expected no wait after the delay, got %v", wait)
+			}
+		}
+	})
+
+	t.Run("should lock out after the max failures", func(t *testing.T) {
+		if wait := limiter.Fail("user"); wait != 15*time.Minute {
+			t.Fatalf("expected a 15 minute lockout, got %v", wait)
+		}
+		now = now.Add(10 * time.Minute)
+		if wait := limiter.Check("user"); wait != 5*time.Minute {
+			t.Errorf("expected 5 more minutes, got %v", wait)
+		}
+		if wait := limiter.Check("other"); wait != 0 {
+			t.Errorf("expected other keys to be unaffected, got %v", wait)
+		}
+	})
+
+	t.Run("should unlock once the lockout is over", func(t *testing.T) {
+		now = now.Add(5*time.Minute + time.Second)
+		if wait := limiter.Check("user"); wait != 0 {
+			t.Errorf("expected no wait, got %v", wait)
+		}
+		if wait := limiter.Fail("user"); wait != 0 {
+			t.Errorf("expected failures to start over, got %v", wait)
+		}
+	})
+
+	t.Run("should unlock on reset", func(t *testing.T) {
+		for i := 0; i < 6; i++ {
+			limiter.Fail("reset")
+		}
+		limiter.Reset("reset")
+		if wait := limiter.Check("reset"); wait != 0 {
+			t.Errorf("expected no wait after reset, got %v", wait)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const orderLookupAudience = "order-lookup"
+
+type OrderLookupClaims struct {
+	jwt.RegisteredClaims
+	OrderID int `json:"orderID"`
+}
+
+// signed link for guests to check their order without an account
+func CreateOrderLookupToken(order *types.Order) (string, error) {
+	expiration := time.Duration(config.Envs.OrderLookupExpirationInSeconds) * time.Second
+
+	subject := ""
+	if order.GuestCustomerID != nil {
+		subject = strconv.Itoa(*order.GuestCustomerID)
+	}
+
+	now := time.Now()
+	return currentKeys().sign(OrderLookupClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Envs.JWTIssuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{orderLookupAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		OrderID: order.ID,
+	})
+}
+
+func ValidateOrderLookupToken(tokenString string) (*OrderLookupClaims, error) {
+	claims := new(OrderLookupClaims)
+	if err := parseClaims(tokenString, claims, orderLookupAudience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
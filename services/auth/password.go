@@ -1,16 +1,182 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, longer passwords are refused instead of cut silently
+var ErrPasswordTooLong = errors.New("password is too long, at most 72 bytes are supported")
+
+/* One password hashing algorithm.
+*	the algorithm and its parameters are encoded in the hash, so hashes of every
+*	supported hasher can be verified and the outdated ones upgraded
+ */
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// whether the hash was made with this algorithm
+	Identifies(hash string) bool
+	Verify(hash, password string) bool
+	// same algorithm but other parameters than configured
+	NeedsRehash(hash string) bool
+}
+
+// the hasher for new passwords, set from PASSWORD_HASHER
+var passwordHasher = newPasswordHasher(config.Envs)
+
+// every hasher a stored hash can come from
+var passwordHashers = []PasswordHasher{&Argon2idHasher{}, &BcryptHasher{}}
+
+func newPasswordHasher(cfg config.Config) PasswordHasher {
+	if cfg.PasswordHasher == "bcrypt" {
+		return &BcryptHasher{Cost: int(cfg.BcryptCost)}
+	}
+	return &Argon2idHasher{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+}
 
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return passwordHasher.Hash(password)
+}
+
+func ComparePasswords(hashed string, plain []byte) bool {
+	for _, hasher := range passwordHashers {
+		if hasher.Identifies(hashed) {
+			return hasher.Verify(hashed, string(plain))
+		}
+	}
+	return false
+}
+
+// whether the hash should be replaced by one of the configured hasher, after the password was verified
+func PasswordNeedsRehash(hashed string) bool {
+	if !passwordHasher.Identifies(hashed) {
+		return true
+	}
+	return passwordHasher.NeedsRehash(hashed)
+}
+
+// RFC 9106, stored in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) bool {
+	p, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory || p.iterations != h.Iterations || p.parallelism != h.Parallelism ||
+		len(p.salt) != argon2SaltLength || len(p.key) != argon2KeyLength
+}
+
+func decodeArgon2Hash(hash string) (*argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	p := new(argon2Params)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	if len(p.key) == 0 {
+		return nil, fmt.Errorf("empty argon2 key")
+	}
+	return p, nil
+}
+
+// the original hasher, still verified for the users that haven't logged in since
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hash), nil
 }
 
-func ComparePasswords(hashed string, plain []byte) bool{
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), plain)
-	return err == nil
+func (h *BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
 }
@@ -1,6 +1,9 @@
 package auth
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestHashPassword(t *testing.T) {
 	hash, err := HashPassword("password")
@@ -28,4 +31,60 @@ func TestCompareHashAndPassword(t *testing.T)  {
 	if ComparePasswords(hash, []byte("notpassword")){
 		t.Errorf("expected hashed password to not match the hash")
 	}
-}
\ No newline at end of file
+}
+func TestPasswordHashers(t *testing.T) {
+	argon := &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+	bcryptHasher := &BcryptHasher{Cost: 4}
+
+	t.Run("should verify hashes of every hasher", func(t *testing.T) {
+		for _, hasher := range []PasswordHasher{argon, bcryptHasher} {
+			hash, err := hasher.Hash("password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ComparePasswords(hash, []byte("password")) {
+				t.Errorf("expected %s to match", hash)
+			}
+			if ComparePasswords(hash, []byte("notpassword")) {
+				t.Errorf("expected %s to not match", hash)
+			}
+		}
+	})
+
+	t.Run("should encode the argon2id parameters", func(t *testing.T) {
+		hash, _ := argon.Hash("password")
+		if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+			t.Errorf("unexpected hash %s", hash)
+		}
+		if argon.NeedsRehash(hash) {
+			t.Errorf("expected no rehash with the same parameters")
+		}
+		if !(&Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1}).NeedsRehash(hash) {
+			t.Errorf("expected a rehash after the parameters changed")
+		}
+	})
+
+	t.Run("should reject passwords bcrypt would truncate", func(t *testing.T) {
+		if _, err := bcryptHasher.Hash(strings.Repeat("a", 73)); err != ErrPasswordTooLong {
+			t.Errorf("expected ErrPasswordTooLong, got %v", err)
+		}
+		if _, err := argon.Hash(strings.Repeat("a", 130)); err != nil {
+			t.Errorf("expected argon2id to take long passwords, got %v", err)
+		}
+	})
+
+	t.Run("should rehash bcrypt hashes", func(t *testing.T) {
+		hash, _ := bcryptHasher.Hash("password")
+		if passwordHasher.Identifies(hash) || !PasswordNeedsRehash(hash) {
+			t.Errorf("expected bcrypt hashes to need a rehash")
+		}
+	})
+
+	t.Run("should not match malformed hashes", func(t *testing.T) {
+		for _, hash := range []string{"", "password", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+			if ComparePasswords(hash, []byte("password")) {
+				t.Errorf("expected %q to not match", hash)
+			}
+		}
+	})
+}
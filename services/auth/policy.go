@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/faldeus0092/go-ecom/config"
+)
+
+// the rules new passwords have to follow, at registration, password change and reset
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// how many of lowercase, uppercase, digits and symbols have to be used
+	MinCharacterClasses int
+	// no email or name in the password
+	ForbidPersonalInfo bool
+	// nil skips the breached password check
+	Breached *BreachedPasswords
+}
+
+var passwordPolicy = &PasswordPolicy{
+	MinLength:           int(config.Envs.PasswordMinLength),
+	MaxLength:           int(config.Envs.PasswordMaxLength),
+	MinCharacterClasses: int(config.Envs.PasswordMinCharacterClasses),
+	ForbidPersonalInfo:  config.Envs.PasswordForbidPersonalInfo,
+}
+
+// check against the configured policy, personal is the email and names of the user
+func CheckPassword(password string, personal ...string) []string {
+	return passwordPolicy.Check(password, personal...)
+}
+
+// every rule the password breaks, nil if it's fine
+func (p *PasswordPolicy) Check(password string, personal ...string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		problems = append(problems, fmt.Sprintf("must use at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+	if p.ForbidPersonalInfo && containsPersonalInfo(password, personal) {
+		problems = append(problems, "must not contain your email or name")
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		problems = append(problems, "appeared in a data breach, choose another one")
+	}
+	return problems
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			classes++
+		}
+	}
+	return classes
+}
+
+// the email counts by its local part too. values under 4 characters are skipped, "Al" or "new" would block too much
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		candidates := []string{value}
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			candidates = append(candidates, value[:at])
+		}
+		for _, candidate := range candidates {
+			if utf8.RuneCountInString(candidate) >= 4 && strings.Contains(password, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, MaxLength: 20, MinCharacterClasses: 3, ForbidPersonalInfo: true}
+
+	t.Run("should accept a good password", func(t *testing.T) {
+		if problems := policy.Check("Correct-horse-7", "jane.doe@example.com", "Jane", "Doe"); problems != nil {
+			t.Errorf("expected no problems, got %v", problems)
+		}
+	})
+
+	t.Run("should report every broken rule", func(t *testing.T) {
+		tests := []struct {
+			password string
+			problems int
+		}{
+			{"Ab1!", 1},
+			{"Abcdefgh1!Abcdefgh1!x", 1},
+			{"abcdefgh", 1},
+			{"Jane.doe-1", 1},
+			{"xJANE.DOEx-1", 1},
+			{"abc", 2},
+		}
+		for _, test := range tests {
+			if problems := policy.Check(test.password, "jane.doe@example.com", "Jane", "Doe"); len(problems) != test.problems {
+				t.Errorf("expected %d problems for %q, got %v", test.problems, test.password, problems)
+			}
+		}
+	})
+
+	t.Run("should skip short personal info", func(t *testing.T) {
+		if problems := policy.Check("Doe-runner-7", "al@example.com", "Al", "Doe"); problems != nil {
+			t.Errorf("expected no problems, got %v", problems)
+		}
+	})
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	filter := NewBreachedPasswords(1000, 0.001)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("breached-%d", i))
+	}
+
+	var buf bytes.Buffer
+	if _, err := filter.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadBreachedPasswords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should find every breached password", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			if !loaded.Contains(fmt.Sprintf("breached-%d", i)) {
+				t.Fatalf("expected breached-%d to be found", i)
+			}
+		}
+	})
+
+	t.Run("should rarely flag other passwords", func(t *testing.T) {
+		falsePositives := 0
+		for i := 0; i < 10000; i++ {
+			if loaded.Contains(fmt.Sprintf("fine-%d", i)) {
+				falsePositives++
+			}
+		}
+		if falsePositives > 50 {
+			t.Errorf("expected about 10 false positives, got %d", falsePositives)
+		}
+	})
+
+	t.Run("should be rejected by the policy", func(t *testing.T) {
+		policy := &PasswordPolicy{MinLength: 8, Breached: loaded}
+		if problems := policy.Check("breached-42"); len(problems) != 1 {
+			t.Errorf("expected the breached password to be refused, got %v", problems)
+		}
+	})
+
+	t.Run("should refuse other files", func(t *testing.T) {
+		if _, err := ReadBreachedPasswords(bytes.NewBufferString("not a filter")); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/utils"
+)
+
+/* Only let users with one of the roles through.
+*	must be wrapped by WithJWTAuth, which puts the role in the request context.
+*	roles listed in REQUIRE_2FA_ROLES also need 2FA enabled
+ */
+func WithRole(handlerFunc http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := GetRoleFromContext(r.Context())
+		for _, allowed := range roles {
+			if role == allowed {
+				if requiresTwoFactor(role) && !hasTwoFactor(r) {
+					utils.WriteError(w, http.StatusForbidden, fmt.Errorf("two-factor authentication required for %s accounts", role))
+					return
+				}
+				handlerFunc(w, r)
+				return
+			}
+		}
+
+		log.Printf("user %d with role %q is not allowed", GetUserIDFromContext(r.Context()), role)
+		permissionDenied(w)
+	}
+}
+
+func requiresTwoFactor(role string) bool {
+	for _, required := range config.Envs.TwoFactorRequiredRoles {
+		if role == required {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTwoFactor(r *http.Request) bool {
+	enabled, _ := r.Context().Value(TwoFactorKey).(bool)
+	return enabled
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestWithRole(t *testing.T) {
+	handler := WithRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, types.RoleStaff, types.RoleAdmin)
+
+	cases := map[string]int{
+		types.RoleAdmin:    http.StatusOK,
+		types.RoleStaff:    http.StatusOK,
+		types.RoleCustomer: http.StatusForbidden,
+		"":                 http.StatusForbidden,
+	}
+	for role, expected := range cases {
+		t.Run("role "+role, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), RoleKey, role))
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != expected {
+				t.Errorf("expected status code %d, got %d", expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestWithRoleRequiresTwoFactor(t *testing.T) {
+	config.Envs.TwoFactorRequiredRoles = []string{types.RoleAdmin}
+	defer func() { config.Envs.TwoFactorRequiredRoles = nil }()
+
+	handler := WithRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, types.RoleStaff, types.RoleAdmin)
+
+	cases := []struct {
+		role      string
+		twoFactor bool
+		expected  int
+	}{
+		{types.RoleAdmin, false, http.StatusForbidden},
+		{types.RoleAdmin, true, http.StatusOK},
+		{types.RoleStaff, false, http.StatusOK},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodPost, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.WithValue(req.Context(), RoleKey, c.role)
+		ctx = context.WithValue(ctx, TwoFactorKey, c.twoFactor)
+
+		rr := httptest.NewRecorder()
+		handler(rr, req.WithContext(ctx))
+		if rr.Code != c.expected {
+			t.Errorf("role %s with 2FA %v: expected status code %d, got %d", c.role, c.twoFactor, c.expected, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 secret "12345678901234567890", last 6 digits
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("at %d expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	t.Run("should accept the current and neighbouring codes", func(t *testing.T) {
+		for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+			code, _ := TOTPCode(secret, now.Add(offset))
+			step, ok := ValidateTOTP(secret, code, now)
+			if !ok {
+				t.Errorf("expected code at offset %v to be valid", offset)
+			}
+			if expected := now.Add(offset).Unix() / totpPeriod; step != expected {
+				t.Errorf("expected step %d, got %d", expected, step)
+			}
+		}
+	})
+
+	t.Run("should reject codes outside the window", func(t *testing.T) {
+		code, _ := TOTPCode(secret, now.Add(-2*time.Minute))
+		if _, ok := ValidateTOTP(secret, code, now); ok {
+			t.Errorf("expected old code to be rejected")
+		}
+	})
+
+	t.Run("should reject malformed codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok := ValidateTOTP(secret, code, now); ok {
+				t.Errorf("expected %q to be rejected", code)
+			}
+		}
+	})
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("go-ecom", "user@example.com", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/go-ecom:user@example.com?") || !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Errorf("unexpected uri %s", uri)
+	}
+
+	png, err := TOTPQRCode(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(png), "\x89PNG") {
+		t.Errorf("expected a PNG")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' || seen[code] {
+			t.Errorf("unexpected code %q", code)
+		}
+		seen[code] = true
+		if normalized := NormalizeRecoveryCode(" " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "); normalized != code {
+			t.Errorf("expected %q, got %q", code, normalized)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	user := &types.User{ID: 7, Email: "user@example.com"}
+
+	t.Run("should round trip the user and email", func(t *testing.T) {
+		token, err := CreateEmailVerificationToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ValidateEmailVerificationToken(token)
+		if err != nil {
+			t.Fatalf("expected token to be valid, got %v", err)
+		}
+		if claims.Subject != "7" || claims.Email != "user@example.com" {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("should not be usable as an access token", func(t *testing.T) {
+		token, _ := CreateEmailVerificationToken(user)
+		if _, err := validateToken(token); err == nil {
+			t.Errorf("expected verification token to be rejected as access token")
+		}
+	})
+
+	t.Run("should not accept an access token", func(t *testing.T) {
+		token, _ := CreateJWT(user, "session")
+		if _, err := ValidateEmailVerificationToken(token); err == nil {
+			t.Errorf("expected access token to be rejected as verification token")
+		}
+	})
+}
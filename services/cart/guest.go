@@ -0,0 +1,122 @@
+package cart
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+/* Checkout without an account.
+*	the order belongs to the guest customer of the email until someone verifies that email on
+*	an account, the lookup token in the response (and the confirmation email) shows its status
+ */
+func (h *Handler) handleGuestCheckout(w http.ResponseWriter, r *http.Request) {
+	var payload types.GuestCheckoutPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	if payload.AddressID != 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("saved addresses need a login, send the address instead"))
+		return
+	}
+
+	productIDs, err := getCartItemsIDs(payload.Items)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	products, err := h.productStore.GetProductsByIDs(productIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	variants, err := h.variantStore.GetVariantsByProductIDs(productIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	guestCustomerID, err := h.store.CreateGuestCustomer(payload.Email)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	orderID, totalPrice, err := h.createOrder(products, variants, payload.Items, types.Order{
+		GuestCustomerID: &guestCustomerID,
+		Address:         payload.Address.String(),
+		ShippingAddress: payload.Address,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, err := auth.CreateOrderLookupToken(&types.Order{ID: orderID, GuestCustomerID: &guestCustomerID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the order went through, a lost email only costs the link
+	if err := h.sendGuestOrderConfirmation(payload.Email, orderID, totalPrice, token); err != nil {
+		log.Printf("failed to send the confirmation of order %d: %v", orderID, err)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"order_id":     orderID,
+		"total_price":  totalPrice,
+		"lookup_token": token,
+	})
+}
+
+// order status and items for the holder of a lookup token
+func (h *Handler) handleOrderLookup(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.ValidateOrderLookupToken(r.URL.Query().Get("token"))
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired order link"))
+		return
+	}
+
+	o, err := h.store.GetOrderByID(claims.OrderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("failed to get order with id %v", claims.OrderID))
+		return
+	}
+	items, err := h.store.GetOrderItemsByOrderID(o.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"order": o,
+		"items": items,
+	})
+}
+
+func (h *Handler) sendGuestOrderConfirmation(email string, orderID int, totalPrice float64, token string) error {
+	return h.mailer.Send(types.Email{
+		To:      email,
+		Subject: fmt.Sprintf("Your order #%d", orderID),
+		Body: fmt.Sprintf("Thanks for your order!\n\nOrder #%d, total %.2f.\n\nCheck its status at any time:\n\n%s/api/v1/order/lookup?token=%s\n\nCreate an account with this email and verify it to see all your orders in one place.",
+			orderID, totalPrice, config.Envs.AppURL, token),
+	})
+}
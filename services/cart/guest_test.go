@@ -0,0 +1,159 @@
+package cart
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/mailer"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestGuestCheckoutHandler(t *testing.T) {
+	store := &mockOrderStore{}
+	products := &mockProductStore{products: []types.Product{{ID: 1, Name: "Desk lamp", Price: 20}}}
+	variants := &mockVariantStore{variants: []types.Variant{{ID: 10, ProductID: 1, SKU: "P1", Quantity: 5, IsDefault: true}}}
+	outbox := mailer.NewOutboxMailer(t.TempDir(), "shop@example.com")
+	handler := NewHandler(store, products, variants, nil, nil, nil, nil, outbox)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/cart/guest-checkout", handler.handleGuestCheckout).Methods(http.MethodPost)
+	router.HandleFunc("/order/lookup", handler.handleOrderLookup).Methods(http.MethodGet)
+
+	serve := func(method, path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	address := &types.PostalAddress{Name: "Guest", Line1: "1 Main St", City: "Springfield", Country: "US"}
+
+	var token string
+	t.Run("should place the order and email the lookup link", func(t *testing.T) {
+		payload := types.GuestCheckoutPayload{
+			CartCheckoutPayload: types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: 2}}, Address: address},
+			Email:               "guest@example.com",
+		}
+		rr := serve(http.MethodPost, "/cart/guest-checkout", payload)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var res struct {
+			OrderID     int     `json:"order_id"`
+			TotalPrice  float64 `json:"total_price"`
+			LookupToken string  `json:"lookup_token"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		if res.OrderID != 1 || res.TotalPrice != 40 || res.LookupToken == "" {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		if store.order.UserID != 0 || store.order.GuestCustomerID == nil || *store.order.GuestCustomerID != 5 {
+			t.Errorf("expected the order to belong to the guest customer, got %+v", store.order)
+		}
+		token = res.LookupToken
+
+		emails, _ := outbox.Messages()
+		if len(emails) != 1 || emails[0].To != "guest@example.com" {
+			t.Fatalf("expected the confirmation to be sent to the guest, got %+v", emails)
+		}
+		if link := config.Envs.AppURL + "/api/v1/order/lookup?token=" + token; !strings.Contains(emails[0].Body, link) {
+			t.Errorf("expected the email to link to %s, got %q", link, emails[0].Body)
+		}
+	})
+
+	t.Run("should refuse a saved address", func(t *testing.T) {
+		payload := types.GuestCheckoutPayload{
+			CartCheckoutPayload: types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: 1}}, AddressID: 3},
+			Email:               "guest@example.com",
+		}
+		if rr := serve(http.MethodPost, "/cart/guest-checkout", payload); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should show the order to the holder of the lookup token", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/order/lookup?token="+token, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var res struct {
+			Order types.Order       `json:"order"`
+			Items []types.OrderItem `json:"items"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		if res.Order.ID != 1 || res.Order.Total != 40 || len(res.Items) != 1 {
+			t.Errorf("unexpected order %+v", res)
+		}
+	})
+
+	t.Run("should refuse an invalid or expired lookup token", func(t *testing.T) {
+		expiration := config.Envs.OrderLookupExpirationInSeconds
+		config.Envs.OrderLookupExpirationInSeconds = -3600
+		expired, err := auth.CreateOrderLookupToken(&types.Order{ID: 1})
+		config.Envs.OrderLookupExpirationInSeconds = expiration
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, token := range []string{"", "not-a-token", expired} {
+			if rr := serve(http.MethodGet, "/order/lookup?token="+token, nil); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		}
+	})
+}
+
+func TestGuestCheckoutRoute(t *testing.T) {
+	checkout := func() int {
+		router := mux.NewRouter()
+		NewHandler(&mockOrderStore{}, &mockProductStore{}, &mockVariantStore{}, nil, nil, nil, nil, nil).RegisterRoutes(router)
+		req, err := http.NewRequest(http.MethodPost, "/cart/guest-checkout", bytes.NewBufferString("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("should be open by default", func(t *testing.T) {
+		if code := checkout(); code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("should not be there with GUEST_CHECKOUT=false", func(t *testing.T) {
+		config.Envs.GuestCheckout = false
+		defer func() { config.Envs.GuestCheckout = true }()
+		if code := checkout(); code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, code)
+		}
+	})
+}
+
+type mockProductStore struct {
+	types.ProductStore
+	products []types.Product
+}
+
+func (m *mockProductStore) GetProductsByIDs(ids []int) ([]types.Product, error) {
+	return m.products, nil
+}
+
+type mockVariantStore struct {
+	types.VariantStore
+	variants []types.Variant
+}
+
+func (m *mockVariantStore) GetVariantsByProductIDs(productIDs []int) ([]types.Variant, error) {
+	return m.variants, nil
+}
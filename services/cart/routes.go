@@ -3,7 +3,9 @@ package cart
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/faldeus0092/go-ecom/config"
 	"github.com/faldeus0092/go-ecom/services/auth"
 	"github.com/faldeus0092/go-ecom/types"
 	"github.com/faldeus0092/go-ecom/utils"
@@ -13,18 +15,33 @@ import (
 
 type Handler struct {
 	store types.OrderStore
-	productStore types.ProductStore // for checking product stock
+	productStore types.ProductStore
+	variantStore types.VariantStore // for checking stock and prices
 	userStore types.UserStore
+	sessionStore types.SessionStore
+	apiKeyStore types.APIKeyStore
+	addressStore types.AddressStore // saved addresses for checkout
+	mailer types.Mailer // guest order confirmations
 }
 
-func NewHandler(store types.OrderStore, productStore types.ProductStore, userStore types.UserStore) (*Handler){
-	return &Handler{store: store, productStore: productStore, userStore: userStore}
+func NewHandler(store types.OrderStore, productStore types.ProductStore, variantStore types.VariantStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore, addressStore types.AddressStore, mailer types.Mailer) (*Handler){
+	return &Handler{store: store, productStore: productStore, variantStore: variantStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore, addressStore: addressStore, mailer: mailer}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router)  {
-	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(h.handleCheckout, h.userStore)).Methods(http.MethodPost)
-	router.HandleFunc("/order/cancel", auth.WithJWTAuth(h.handleCancellation, h.userStore)).Methods(http.MethodPost)
-	router.HandleFunc("/order", auth.WithJWTAuth(h.handleGetOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleCheckout), h.userStore, h.sessionStore)).Methods(http.MethodPost)
+	router.HandleFunc("/order/cancel", auth.WithJWTAuth(h.handleCancellation, h.userStore, h.sessionStore)).Methods(http.MethodPost)
+	router.HandleFunc("/order", auth.WithJWTAuth(h.handleGetOrders, h.userStore, h.sessionStore)).Methods(http.MethodGet)
+
+	// buying without an account, not when checkout needs a verified email
+	if config.Envs.GuestCheckout && !config.Envs.RequireVerifiedEmailForCheckout {
+		router.HandleFunc("/cart/guest-checkout", h.handleGuestCheckout).Methods(http.MethodPost)
+	}
+	router.HandleFunc("/order/lookup", h.handleOrderLookup).Methods(http.MethodGet)
+
+	// order administration, also open to API keys (warehouse, ERP)
+	router.HandleFunc("/admin/orders/{orderID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleAdminGetOrder, types.ScopeOrdersRead, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/{orderID}/status", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleAdminUpdateOrderStatus, types.ScopeOrdersWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPut)
 }
 
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
@@ -35,6 +52,18 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 
 	// user ID is obtainable through JWT token
 	userID := auth.GetUserIDFromContext(r.Context())
+
+	if config.Envs.RequireVerifiedEmailForCheckout {
+		u, err := h.userStore.GetUserByID(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if u.VerifiedAt == nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("email must be verified before checkout"))
+			return
+		}
+	}
 	
 	// parse
 	if err := utils.ParseJSON(r, &cart); err != nil{
@@ -53,15 +82,32 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 	productIDs, err := getCartItemsIDs(cart.Items)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
+		return
 	}
 	// query into array of types.Product
 	products, err := h.productStore.GetProductsByIDs(productIDs)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	variants, err := h.variantStore.GetVariantsByProductIDs(productIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
 	
 	// create new order and create every order items
-	orderID, totalPrice, err := h.createOrder(products, cart, userID)
+	shipping, err := h.shippingAddress(cart, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orderID, totalPrice, err := h.createOrder(products, variants, cart.Items, types.Order{
+		UserID: userID,
+		Address: shipping.String(),
+		ShippingAddress: shipping,
+	})
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
@@ -129,3 +175,56 @@ func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request)  {
 
 	utils.WriteJSON(w, http.StatusOK, products)
 }
+
+func (h *Handler) handleAdminGetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order id"))
+		return
+	}
+
+	o, err := h.store.GetOrderByID(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("failed to get order with id %v", orderID))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, o)
+}
+
+func (h *Handler) handleAdminUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order id"))
+		return
+	}
+
+	var payload types.OrderStatusPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	o, err := h.store.GetOrderByID(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("failed to get order with id %v", orderID))
+		return
+	}
+
+	o.Status = payload.Status
+	if err := h.store.UpdateOrder(*o); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, o)
+}
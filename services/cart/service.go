@@ -1,7 +1,9 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
+
 	"github.com/faldeus0092/go-ecom/types"
 )
 
@@ -21,79 +23,115 @@ func getCartItemsIDs(items []types.CartItem) ([]int, error) {
 }
 
 /* Create order based on array of 
+*	order carries the user (or guest customer) and the shipping address
+*	variants are the active variants of the products, items without a variant get the default one
 *	returns order id, total price, and error
 */
-func (h *Handler) createOrder(products []types.Product, cart types.CartCheckoutPayload, userID int) (int, float64, error){
+func (h *Handler) createOrder(products []types.Product, variants []types.Variant, items []types.CartItem, order types.Order) (int, float64, error){
 	// for convenience
 	productMap := make(map[int]types.Product)
 	for _, product := range products {
 		productMap[product.ID] = product
 	}
+	variantMap := make(map[int]types.Variant)
+	defaultVariants := make(map[int]int)
+	for _, v := range variants {
+		variantMap[v.ID] = v
+		if v.IsDefault {
+			defaultVariants[v.ProductID] = v.ID
+		}
+	}
+	resolved := make([]types.CartItem, len(items))
+	for i, item := range items {
+		if item.VariantID == 0 {
+			item.VariantID = defaultVariants[item.ProductID]
+		}
+		resolved[i] = item
+	}
+	items = resolved
 	
 	// check if all products in stock
-	if err := checkIfCartIsInStock(cart.Items, productMap); err != nil{
+	if err := checkIfCartIsInStock(items, productMap, variantMap); err != nil{
 		return 0, 0, err
 	}
 	// calculate the total price
-	totalPrice := calculateTotalPrice(cart.Items, productMap)
+	totalPrice := calculateTotalPrice(items, productMap, variantMap)
 	
-	// reduce quantity of products in our db
-	for _, item := range cart.Items {
-		product := productMap[item.ProductID]
-		product.Quantity -= item.Quantity
-		h.productStore.UpdateProduct(product)
+	orderItems := make([]types.OrderItem, len(items))
+	for i, item := range items {
+		variantID := item.VariantID
+		orderItems[i] = types.OrderItem{
+			ProductID: item.ProductID,
+			VariantID: &variantID,
+			Quantity: item.Quantity,
+			Price: variantMap[item.VariantID].UnitPrice(productMap[item.ProductID]),
+		}
 	}
 	
-	// create the order
-	orderID, err := h.store.CreateOrder(types.Order{
-		UserID: userID,
-		Total: totalPrice,
-		Status: "pending", //todo
-		Address: cart.Address,
-	})
+	// take the stock and create the order with its items, the stock could have run out since the check
+	order.Total = totalPrice
+	order.Status = "pending" //todo
+	orderID, err := h.store.PlaceOrder(order, orderItems)
+	if errors.Is(err, types.ErrInsufficientStock) {
+		return 0, 0, fmt.Errorf("insufficient stock, please refresh cart")
+	}
 	if err != nil {
 		return 0, 0, err
 	}
 
-	// create order cart.Items
-	for _, item := range cart.Items {
-		h.store.CreateOrderItem(types.OrderItem{
-			OrderID: orderID,
-			ProductID: item.ProductID,
-			Quantity: item.Quantity,
-			Price: productMap[item.ProductID].Price,
-		})
-	}
-
 	return orderID, totalPrice, nil
 }
 
-func checkIfCartIsInStock(cartItems []types.CartItem, products map[int]types.Product) error {
-	// cartItems => contains product id and bought quantity
-	// products => contains product data stored in DB
+/* The address to ship the order to, as it is now.
+*	a saved address has to belong to the user, the order gets a copy so later edits don't change it
+ */
+func (h *Handler) shippingAddress(cart types.CartCheckoutPayload, userID int) (*types.PostalAddress, error) {
+	if cart.AddressID == 0 {
+		return cart.Address, nil
+	}
+	a, err := h.addressStore.GetAddressByID(cart.AddressID)
+	if err != nil || a.UserID != userID {
+		return nil, fmt.Errorf("address with id %d not found", cart.AddressID)
+	}
+	shipping := a.PostalAddress
+	return &shipping, nil
+}
+
+/* cartItems => contains product id, variant id and bought quantity
+*	products and variants => data stored in DB, by id
+*	the same variant can be in the cart more than once, the stock has to cover all of them
+ */
+func checkIfCartIsInStock(cartItems []types.CartItem, products map[int]types.Product, variants map[int]types.Variant) error {
 	if len(cartItems) == 0 {
 		return fmt.Errorf("cart is empty")
 	}
 
+	ordered := make(map[int]int)
 	for _, item := range cartItems {
 		product, ok := products[item.ProductID]
-		if !ok {
+		// deleted products still come back by id, for the orders that have them
+		if !ok || product.DeletedAt != nil {
 			return fmt.Errorf("product with id %d not available, please refresh cart", item.ProductID)
 		}
-		if item.Quantity > int(product.Quantity){
-			return fmt.Errorf("insufficient stock for product %s", product.Name)
+		variant, ok := variants[item.VariantID]
+		if !ok || variant.ProductID != item.ProductID {
+			return fmt.Errorf("variant with id %d of product %s not available, please refresh cart", item.VariantID, product.Name)
+		}
+		ordered[variant.ID] += item.Quantity
+		if ordered[variant.ID] > variant.Quantity {
+			return fmt.Errorf("insufficient stock for product %s (%s)", product.Name, variant.SKU)
 		}
-
 	}
 
 	return nil
 }
 
-func calculateTotalPrice(cartItems []types.CartItem, products map[int]types.Product) float64 {
+// a variant without its own price costs what the product does
+func calculateTotalPrice(cartItems []types.CartItem, products map[int]types.Product, variants map[int]types.Variant) float64 {
 	var total float64 = 0.00
 	for _, item := range cartItems {
-		product := products[item.ProductID]
-		total += product.Price*float64(item.Quantity)
+		price := variants[item.VariantID].UnitPrice(products[item.ProductID])
+		total += price*float64(item.Quantity)
 	}
 	return total
 }
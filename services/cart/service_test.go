@@ -0,0 +1,161 @@
+package cart
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestCheckIfCartIsInStock(t *testing.T) {
+	deletedAt := time.Now()
+	products := map[int]types.Product{
+		1: {ID: 1, Name: "Desk lamp", Price: 20},
+		2: {ID: 2, Name: "Old lamp", Price: 15, DeletedAt: &deletedAt},
+	}
+	variants := map[int]types.Variant{
+		10: {ID: 10, ProductID: 1, SKU: "P1", Quantity: 5, IsDefault: true},
+		20: {ID: 20, ProductID: 2, SKU: "P2", Quantity: 5, IsDefault: true},
+	}
+
+	t.Run("should refuse a deleted product", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 2, VariantID: 20, Quantity: 1}}
+		if err := checkIfCartIsInStock(items, products, variants); err == nil {
+			t.Errorf("expected the deleted product to be refused")
+		}
+	})
+
+	t.Run("should refuse a product that doesn't exist", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 3, VariantID: 10, Quantity: 1}}
+		if err := checkIfCartIsInStock(items, products, variants); err == nil {
+			t.Errorf("expected the unknown product to be refused")
+		}
+	})
+
+	t.Run("should accept a product in stock", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 1, VariantID: 10, Quantity: 5}}
+		if err := checkIfCartIsInStock(items, products, variants); err != nil {
+			t.Errorf("expected the cart to be in stock, got %v", err)
+		}
+	})
+
+	t.Run("should count the same variant twice against its stock", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 1, VariantID: 10, Quantity: 3}, {ProductID: 1, VariantID: 10, Quantity: 3}}
+		if err := checkIfCartIsInStock(items, products, variants); err == nil {
+			t.Errorf("expected 6 of a variant with 5 left to be refused")
+		}
+	})
+
+	t.Run("should refuse a variant of another product", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 1, VariantID: 20, Quantity: 1}}
+		if err := checkIfCartIsInStock(items, products, variants); err == nil {
+			t.Errorf("expected the variant of another product to be refused")
+		}
+	})
+}
+
+func TestCalculateTotalPrice(t *testing.T) {
+	override := 12.5
+	products := map[int]types.Product{1: {ID: 1, Name: "T-shirt", Price: 10}}
+	variants := map[int]types.Variant{
+		10: {ID: 10, ProductID: 1, SKU: "TS-M", Quantity: 5, IsDefault: true},
+		11: {ID: 11, ProductID: 1, SKU: "TS-XL", Quantity: 5, Price: &override},
+	}
+
+	t.Run("should use the product price for a variant without its own", func(t *testing.T) {
+		if total := calculateTotalPrice([]types.CartItem{{ProductID: 1, VariantID: 10, Quantity: 2}}, products, variants); total != 20 {
+			t.Errorf("expected 20, got %v", total)
+		}
+	})
+
+	t.Run("should use the price of the variant when it has one", func(t *testing.T) {
+		items := []types.CartItem{{ProductID: 1, VariantID: 11, Quantity: 2}, {ProductID: 1, VariantID: 10, Quantity: 1}}
+		if total := calculateTotalPrice(items, products, variants); total != 35 {
+			t.Errorf("expected 35, got %v", total)
+		}
+	})
+}
+
+func TestCreateOrder(t *testing.T) {
+	override := 12.5
+	products := []types.Product{{ID: 1, Name: "T-shirt", Price: 10}}
+	variants := []types.Variant{
+		{ID: 10, ProductID: 1, SKU: "TS-M", Quantity: 5, IsDefault: true},
+		{ID: 11, ProductID: 1, SKU: "TS-XL", Quantity: 5, Price: &override},
+	}
+
+	t.Run("should order the default variant when the item has none", func(t *testing.T) {
+		store := &mockOrderStore{}
+		handler := NewHandler(store, nil, nil, nil, nil, nil, nil, nil)
+		items := []types.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 1, VariantID: 11, Quantity: 1}}
+
+		orderID, total, err := handler.createOrder(products, variants, items, types.Order{UserID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if orderID != 1 || total != 32.5 || store.order.Total != 32.5 || store.order.UserID != 1 {
+			t.Errorf("unexpected order %d %v %+v", orderID, total, store.order)
+		}
+		if len(store.items) != 2 || *store.items[0].VariantID != 10 || store.items[0].Price != 10 || *store.items[1].VariantID != 11 || store.items[1].Price != 12.5 {
+			t.Errorf("unexpected order items %+v", store.items)
+		}
+	})
+
+	t.Run("should not place the order when a variant has too little stock", func(t *testing.T) {
+		store := &mockOrderStore{}
+		handler := NewHandler(store, nil, nil, nil, nil, nil, nil, nil)
+		items := []types.CartItem{{ProductID: 1, Quantity: 4}, {ProductID: 1, VariantID: 10, Quantity: 2}}
+
+		if _, _, err := handler.createOrder(products, variants, items, types.Order{UserID: 1}); err == nil {
+			t.Fatalf("expected the order to be refused")
+		}
+		if store.items != nil {
+			t.Errorf("expected no order to be placed, got %+v", store.items)
+		}
+	})
+
+	t.Run("should ask for a refresh when the stock ran out while placing the order", func(t *testing.T) {
+		store := &mockOrderStore{err: fmt.Errorf("%w for variant 10", types.ErrInsufficientStock)}
+		handler := NewHandler(store, nil, nil, nil, nil, nil, nil, nil)
+
+		_, _, err := handler.createOrder(products, variants, []types.CartItem{{ProductID: 1, Quantity: 1}}, types.Order{UserID: 1})
+		if err == nil || err.Error() != "insufficient stock, please refresh cart" {
+			t.Errorf("expected the insufficient stock to be reported, got %v", err)
+		}
+	})
+}
+
+// remembers the last order placed, or fails with err
+type mockOrderStore struct {
+	types.OrderStore
+	order types.Order
+	items []types.OrderItem
+	err   error
+}
+
+func (m *mockOrderStore) PlaceOrder(order types.Order, items []types.OrderItem) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	order.ID = 1
+	m.order = order
+	m.items = items
+	return 1, nil
+}
+
+func (m *mockOrderStore) CreateGuestCustomer(email string) (int, error) {
+	return 5, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(orderID int) (*types.Order, error) {
+	if m.items == nil || orderID != m.order.ID {
+		return nil, fmt.Errorf("order not found")
+	}
+	order := m.order
+	return &order, nil
+}
+
+func (m *mockOrderStore) GetOrderItemsByOrderID(orderID int) ([]types.OrderItem, error) {
+	return m.items, nil
+}
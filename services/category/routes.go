@@ -0,0 +1,304 @@
+package category
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+var (
+	slugPattern    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	nonSlugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Handler struct {
+	store        types.CategoryStore
+	productStore types.ProductStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	apiKeyStore  types.APIKeyStore
+}
+
+func NewHandler(store types.CategoryStore, productStore types.ProductStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore) *Handler {
+	return &Handler{store: store, productStore: productStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore}
+}
+
+// the products of a category are listed by the product handler, GET /categories/{slug}/products
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/categories", h.handleGetCategories).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}/categories", h.handleGetProductCategories).Methods(http.MethodGet)
+	// catalog writes are for staff and admins only, or API keys with products:write
+	router.HandleFunc("/categories", h.catalogWrite(h.handleCreateCategory)).Methods(http.MethodPost)
+	router.HandleFunc("/categories/{categoryID:[0-9]+}", h.catalogWrite(h.handleUpdateCategory)).Methods(http.MethodPut)
+	router.HandleFunc("/categories/{categoryID:[0-9]+}", h.catalogWrite(h.handleDeleteCategory)).Methods(http.MethodDelete)
+	router.HandleFunc("/products/{productID}/categories", h.catalogWrite(h.handleSetProductCategories)).Methods(http.MethodPut)
+}
+
+func (h *Handler) catalogWrite(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return auth.WithJWTOrAPIKey(auth.WithScopeOrRole(handlerFunc, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)
+}
+
+// the whole tree, every level ordered by position then name
+func (h *Handler) handleGetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, buildTree(categories, nil))
+}
+
+func (h *Handler) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	payload, ok := parseCategoryPayload(w, r)
+	if !ok {
+		return
+	}
+
+	c := types.Category{Name: payload.Name, Slug: payload.Slug, ParentID: payload.ParentID, Position: payload.Position}
+	if !h.checkCategory(w, c) {
+		return
+	}
+
+	categoryID, err := h.store.CreateCategory(c)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	created, err := h.store.GetCategoryByID(categoryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+// moving a category moves everything below it along
+func (h *Handler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pathCategory(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := parseCategoryPayload(w, r)
+	if !ok {
+		return
+	}
+
+	c.Name = payload.Name
+	c.Slug = payload.Slug
+	c.ParentID = payload.ParentID
+	c.Position = payload.Position
+	if !h.checkCategory(w, *c) {
+		return
+	}
+
+	if err := h.store.UpdateCategory(*c); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, c)
+}
+
+// only empty branches can go, the products in it just lose the category
+func (h *Handler) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.pathCategory(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, child := range categories {
+		if child.ParentID != nil && *child.ParentID == c.ID {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("category %s has subcategories, move or delete them first", c.Slug))
+			return
+		}
+	}
+
+	if err := h.store.DeleteCategory(c.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "category deleted"})
+}
+
+func (h *Handler) handleGetProductCategories(w http.ResponseWriter, r *http.Request) {
+	productID, ok := h.pathProductID(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := h.store.GetProductCategories(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, categories)
+}
+
+// replaces the categories of the product, an empty list takes it out of every category
+func (h *Handler) handleSetProductCategories(w http.ResponseWriter, r *http.Request) {
+	var payload types.ProductCategoriesPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	productID, ok := h.pathProductID(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	known := make(map[int]bool)
+	for _, c := range categories {
+		known[c.ID] = true
+	}
+	for _, categoryID := range payload.CategoryIDs {
+		if !known[categoryID] {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("category with id %d not found", categoryID))
+			return
+		}
+	}
+
+	if err := h.store.SetProductCategories(productID, payload.CategoryIDs); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.handleGetProductCategories(w, r)
+}
+
+// the slug has to be free, the parent has to exist and can't be the category itself or below it
+func (h *Handler) checkCategory(w http.ResponseWriter, c types.Category) bool {
+	if !slugPattern.MatchString(c.Slug) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("slug must be lowercase letters and digits separated by single dashes"))
+		return false
+	}
+	if existing, err := h.store.GetCategoryBySlug(c.Slug); err == nil && existing.ID != c.ID {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("category with slug %s already exists", c.Slug))
+		return false
+	}
+	if c.ParentID == nil {
+		return true
+	}
+
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	byID := make(map[int]types.Category)
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	if _, ok := byID[*c.ParentID]; !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("parent category with id %d not found", *c.ParentID))
+		return false
+	}
+	// walk up from the new parent, finding the category itself there would make a cycle
+	for parentID, steps := c.ParentID, 0; parentID != nil && steps <= len(byID); parentID, steps = byID[*parentID].ParentID, steps+1 {
+		if c.ID != 0 && *parentID == c.ID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a category can't be moved below itself"))
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) pathCategory(w http.ResponseWriter, r *http.Request) (*types.Category, bool) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid category id"))
+		return nil, false
+	}
+
+	c, err := h.store.GetCategoryByID(categoryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("category with id %d not found", categoryID))
+		return nil, false
+	}
+	return c, true
+}
+
+// deleted products are not found
+func (h *Handler) pathProductID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product id"))
+		return 0, false
+	}
+
+	product, err := h.productStore.GetProductByID(productID)
+	if err != nil || product.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with id %d not found", productID))
+		return 0, false
+	}
+	return productID, true
+}
+
+func parseCategoryPayload(w http.ResponseWriter, r *http.Request) (*types.CategoryPayload, bool) {
+	var payload types.CategoryPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return nil, false
+	}
+
+	if payload.Slug == "" {
+		payload.Slug = slugify(payload.Name)
+	}
+	return &payload, true
+}
+
+// "Shoes & Bags" => "shoes-bags"
+func slugify(name string) string {
+	return strings.Trim(nonSlugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// the children of parent (the top level for nil) with theirs below them, in the order of categories
+func buildTree(categories []types.Category, parent *int) []types.Category {
+	children := make([]types.Category, 0)
+	for _, c := range categories {
+		if (parent == nil && c.ParentID == nil) || (parent != nil && c.ParentID != nil && *c.ParentID == *parent) {
+			c.Children = buildTree(categories, &c.ID)
+			children = append(children, c)
+		}
+	}
+	return children
+}
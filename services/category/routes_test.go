@@ -0,0 +1,213 @@
+package category
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestCategoryHandler(t *testing.T) {
+	store := &mockCategoryStore{products: make(map[int][]int)}
+	handler := NewHandler(store, &mockProductStore{}, nil, nil, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/categories", handler.handleGetCategories).Methods(http.MethodGet)
+	router.HandleFunc("/categories", handler.handleCreateCategory).Methods(http.MethodPost)
+	router.HandleFunc("/categories/{categoryID:[0-9]+}", handler.handleUpdateCategory).Methods(http.MethodPut)
+	router.HandleFunc("/categories/{categoryID:[0-9]+}", handler.handleDeleteCategory).Methods(http.MethodDelete)
+	router.HandleFunc("/products/{productID}/categories", handler.handleSetProductCategories).Methods(http.MethodPut)
+
+	serve := func(method, path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	parent := func(id int) *int { return &id }
+
+	t.Run("should create categories with a slug from the name", func(t *testing.T) {
+		for _, payload := range []types.CategoryPayload{
+			{Name: "Clothing", Position: 2},
+			{Name: "Electronics", Position: 1},
+			{Name: "Shoes & Boots", ParentID: parent(1)},
+			{Name: "Running shoes", ParentID: parent(3)},
+		} {
+			if rr := serve(http.MethodPost, "/categories", payload); rr.Code != http.StatusCreated {
+				t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+			}
+		}
+		if slug := store.categories[2].Slug; slug != "shoes-boots" {
+			t.Errorf("expected slug shoes-boots, got %s", slug)
+		}
+	})
+
+	t.Run("should refuse a taken slug or a missing parent", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/categories", types.CategoryPayload{Name: "Clothing!"}); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if rr := serve(http.MethodPost, "/categories", types.CategoryPayload{Name: "Hats", ParentID: parent(99)}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return the nested tree ordered by position", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/categories", nil)
+		var tree []types.Category
+		json.NewDecoder(rr.Body).Decode(&tree)
+		if len(tree) != 2 || tree[0].Slug != "electronics" || tree[1].Slug != "clothing" {
+			t.Fatalf("unexpected top level %+v", tree)
+		}
+		shoes := tree[1].Children
+		if len(shoes) != 1 || len(shoes[0].Children) != 1 || shoes[0].Children[0].Slug != "running-shoes" {
+			t.Errorf("unexpected children %+v", shoes)
+		}
+	})
+
+	t.Run("should not move a category below itself", func(t *testing.T) {
+		for _, parentID := range []int{1, 4} {
+			rr := serve(http.MethodPut, "/categories/1", types.CategoryPayload{Name: "Clothing", ParentID: parent(parentID)})
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d for parent %d, got %d", http.StatusBadRequest, parentID, rr.Code)
+			}
+		}
+		if rr := serve(http.MethodPut, "/categories/4", types.CategoryPayload{Name: "Running shoes", ParentID: parent(1)}); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should only delete categories without subcategories", func(t *testing.T) {
+		if rr := serve(http.MethodDelete, "/categories/1", nil); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if rr := serve(http.MethodDelete, "/categories/2", nil); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should set the categories of a product", func(t *testing.T) {
+		if rr := serve(http.MethodPut, "/products/1/categories", types.ProductCategoriesPayload{CategoryIDs: []int{2}}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected the deleted category to be refused, got %d", rr.Code)
+		}
+		if rr := serve(http.MethodPut, "/products/1/categories", types.ProductCategoriesPayload{CategoryIDs: []int{3, 4}}); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if got := fmt.Sprint(store.products[1]); got != "[3 4]" {
+			t.Errorf("expected categories [3 4], got %s", got)
+		}
+		if rr := serve(http.MethodPut, "/products/2/categories", types.ProductCategoriesPayload{CategoryIDs: []int{3}}); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+// in memory CategoryStore, ordered like the database would
+type mockCategoryStore struct {
+	categories []types.Category
+	// product id => category ids
+	products map[int][]int
+}
+
+func (m *mockCategoryStore) GetCategories() ([]types.Category, error) {
+	categories := make([]types.Category, len(m.categories))
+	copy(categories, m.categories)
+	for i := range categories {
+		for j := i + 1; j < len(categories); j++ {
+			a, b := categories[i], categories[j]
+			if b.Position < a.Position || (b.Position == a.Position && b.Name < a.Name) {
+				categories[i], categories[j] = b, a
+			}
+		}
+	}
+	return categories, nil
+}
+
+func (m *mockCategoryStore) GetCategoryByID(id int) (*types.Category, error) {
+	for _, c := range m.categories {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("category not found")
+}
+
+func (m *mockCategoryStore) GetCategoryBySlug(slug string) (*types.Category, error) {
+	for _, c := range m.categories {
+		if c.Slug == slug {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("category not found")
+}
+
+func (m *mockCategoryStore) GetDescendantCategoryIDs(categoryID int) ([]int, error) {
+	ids := []int{categoryID}
+	for _, c := range m.categories {
+		if c.ParentID != nil && *c.ParentID == categoryID {
+			children, _ := m.GetDescendantCategoryIDs(c.ID)
+			ids = append(ids, children...)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockCategoryStore) CreateCategory(c types.Category) (int, error) {
+	c.ID = len(m.categories) + 1
+	m.categories = append(m.categories, c)
+	return c.ID, nil
+}
+
+func (m *mockCategoryStore) UpdateCategory(c types.Category) error {
+	for i := range m.categories {
+		if m.categories[i].ID == c.ID {
+			m.categories[i] = c
+		}
+	}
+	return nil
+}
+
+func (m *mockCategoryStore) DeleteCategory(id int) error {
+	for i := range m.categories {
+		if m.categories[i].ID == id {
+			m.categories = append(m.categories[:i], m.categories[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockCategoryStore) GetProductCategories(productID int) ([]types.Category, error) {
+	categories := make([]types.Category, 0)
+	for _, id := range m.products[productID] {
+		if c, err := m.GetCategoryByID(id); err == nil {
+			categories = append(categories, *c)
+		}
+	}
+	return categories, nil
+}
+
+func (m *mockCategoryStore) SetProductCategories(productID int, categoryIDs []int) error {
+	m.products[productID] = categoryIDs
+	return nil
+}
+
+// only product 1 exists
+type mockProductStore struct {
+	types.ProductStore
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
+	if id != 1 {
+		return nil, fmt.Errorf("product not found")
+	}
+	return &types.Product{ID: 1, Name: "Trail runner"}, nil
+}
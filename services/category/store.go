@@ -0,0 +1,158 @@
+package category
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetCategories() ([]types.Category, error) {
+	return s.queryCategories("SELECT id, parentId, name, slug, position, createdAt FROM categories ORDER BY position, name")
+}
+
+func (s *Store) GetCategoryByID(id int) (*types.Category, error) {
+	return s.getCategory("SELECT id, parentId, name, slug, position, createdAt FROM categories WHERE id = ?", id)
+}
+
+func (s *Store) GetCategoryBySlug(slug string) (*types.Category, error) {
+	return s.getCategory("SELECT id, parentId, name, slug, position, createdAt FROM categories WHERE slug = ?", slug)
+}
+
+// the tree has no cycles (the handler refuses them), so the recursion ends
+func (s *Store) GetDescendantCategoryIDs(categoryID int) ([]int, error) {
+	rows, err := s.db.Query(`WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM categories c JOIN tree t ON c.parentId = t.id
+		)
+		SELECT id FROM tree`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *Store) CreateCategory(c types.Category) (int, error) {
+	res, err := s.db.Exec("INSERT INTO categories (parentId, name, slug, position) VALUES (?, ?, ?, ?)", c.ParentID, c.Name, c.Slug, c.Position)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *Store) UpdateCategory(c types.Category) error {
+	_, err := s.db.Exec("UPDATE categories SET parentId = ?, name = ?, slug = ?, position = ? WHERE id = ?", c.ParentID, c.Name, c.Slug, c.Position, c.ID)
+	return err
+}
+
+// the products stay, only their link to the category goes
+func (s *Store) DeleteCategory(id int) error {
+	_, err := s.db.Exec("DELETE FROM categories WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) GetProductCategories(productID int) ([]types.Category, error) {
+	return s.queryCategories(`SELECT c.id, c.parentId, c.name, c.slug, c.position, c.createdAt
+		FROM categories c JOIN product_categories pc ON pc.categoryId = c.id
+		WHERE pc.productId = ?
+		ORDER BY c.position, c.name`, productID)
+}
+
+func (s *Store) SetProductCategories(productID int, categoryIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM product_categories WHERE productId = ?", productID); err != nil {
+		return err
+	}
+	if len(categoryIDs) > 0 {
+		placeholders := strings.Repeat(",(?, ?)", len(categoryIDs)-1)
+		args := make([]interface{}, 0, len(categoryIDs)*2)
+		for _, categoryID := range categoryIDs {
+			args = append(args, productID, categoryID)
+		}
+		_, err := tx.Exec(fmt.Sprintf("INSERT IGNORE INTO product_categories (productId, categoryId) VALUES (?, ?)%s", placeholders), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) getCategory(query string, args ...interface{}) (*types.Category, error) {
+	categories, err := s.queryCategories(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("category not found")
+	}
+	return &categories[0], nil
+}
+
+func (s *Store) queryCategories(query string, args ...interface{}) ([]types.Category, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]types.Category, 0)
+	for rows.Next() {
+		c, err := scanRowIntoCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, *c)
+	}
+	return categories, nil
+}
+
+func scanRowIntoCategory(rows *sql.Rows) (*types.Category, error) {
+	c := new(types.Category)
+	var parentID sql.NullInt64
+	err := rows.Scan(
+		&c.ID,
+		&parentID,
+		&c.Name,
+		&c.Slug,
+		&c.Position,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		c.ParentID = &id
+	}
+	return c, nil
+}
@@ -0,0 +1,137 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+const (
+	// login history included in the export
+	exportLoginAttemptsLimit = 1000
+	// a pending export older than this isn't running anymore
+	exportTimeout = 30 * time.Minute
+	// how often expired export files are removed
+	exportCleanupInterval = time.Hour
+)
+
+// remove expired export files now and every exportCleanupInterval after, for as long as the process runs
+func (h *Handler) StartCleanup() {
+	go func() {
+		for {
+			removed, err := h.store.RemoveExpiredExportFiles()
+			if err != nil {
+				log.Printf("failed to remove expired exports: %v", err)
+			} else if removed > 0 {
+				log.Printf("removed %d expired export file(s)", removed)
+			}
+			time.Sleep(exportCleanupInterval)
+		}
+	}()
+}
+
+func (h *Handler) runExport(export *types.DataExport) {
+	filePath, err := h.writeExport(export)
+	if err != nil {
+		log.Printf("failed to build export %d: %v", export.ID, err)
+		if err := h.store.FailExport(export.ID); err != nil {
+			log.Printf("failed to mark export %d as failed: %v", export.ID, err)
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(config.Envs.DataExportExpirationInSeconds) * time.Second)
+	if err := h.store.CompleteExport(export.ID, filePath, expiresAt); err != nil {
+		log.Printf("failed to complete export %d: %v", export.ID, err)
+	}
+	// the account was deleted while the export was built, its rows are gone and the file has to go too
+	if _, err := h.store.GetExportByID(export.ID); err != nil {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("failed to remove export %d of a deleted account: %v", export.ID, err)
+		}
+	}
+}
+
+// collect the data of the user and write it as export.json in a zip file
+func (h *Handler) writeExport(export *types.DataExport) (string, error) {
+	bundle, err := h.collect(export.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(config.Envs.DataExportDir, 0700); err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(config.Envs.DataExportDir, fmt.Sprintf("export-%d-%d.zip", export.UserID, export.ID))
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+	entry, err := archive.Create("export.json")
+	if err != nil {
+		return "", err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bundle); err != nil {
+		return "", err
+	}
+	if err := archive.Close(); err != nil {
+		return "", err
+	}
+	return filePath, f.Close()
+}
+
+func (h *Handler) collect(userID int) (*types.DataExportBundle, error) {
+	u, err := h.userStore.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := h.orderStore.GetOrdersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &types.DataExportBundle{
+		ExportedAt: time.Now(),
+		User:       *u,
+		Orders:     make([]types.ExportedOrder, 0, len(orders)),
+		Addresses:  make([]string, 0),
+	}
+
+	seen := map[string]bool{}
+	for _, order := range orders {
+		items, err := h.orderStore.GetOrderItemsByOrderID(order.ID)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Orders = append(bundle.Orders, types.ExportedOrder{Order: order, Items: items})
+
+		if order.Address != "" && !seen[order.Address] {
+			seen[order.Address] = true
+			bundle.Addresses = append(bundle.Addresses, order.Address)
+		}
+	}
+
+	bundle.AddressBook, err = h.addressStore.GetAddressesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.LoginHistory, err = h.userStore.GetLoginAttempts(types.LoginAttemptFilter{UserID: userID, Limit: exportLoginAttemptsLimit})
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
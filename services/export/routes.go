@@ -0,0 +1,153 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store        types.DataExportStore
+	userStore    types.UserStore
+	orderStore   types.OrderStore
+	addressStore types.AddressStore
+	sessionStore types.SessionStore
+	// running export jobs, waited on in tests
+	jobs sync.WaitGroup
+}
+
+func NewHandler(store types.DataExportStore, userStore types.UserStore, orderStore types.OrderStore, addressStore types.AddressStore, sessionStore types.SessionStore) *Handler {
+	return &Handler{store: store, userStore: userStore, orderStore: orderStore, addressStore: addressStore, sessionStore: sessionStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/me/export", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleRequestExport), h.userStore, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/me/export", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleGetExport), h.userStore, h.sessionStore)).Methods("GET")
+	// authenticated by the signed token in the link, so it can be opened in a browser
+	router.HandleFunc("/me/export/{exportID}/download", h.handleDownloadExport).Methods("GET")
+}
+
+/* Start building a new export in the background.
+*	poll GET /me/export until it's ready, only one export runs per user at a time
+ */
+func (h *Handler) handleRequestExport(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	latest, err := h.latestExport(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if latest != nil && latest.Status == types.DataExportPending {
+		utils.WriteJSON(w, http.StatusAccepted, latest)
+		return
+	}
+
+	exportID, err := h.store.CreateExport(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	export, err := h.store.GetExportByID(exportID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.jobs.Add(1)
+	go func() {
+		defer h.jobs.Done()
+		h.runExport(export)
+	}()
+
+	utils.WriteJSON(w, http.StatusAccepted, export)
+}
+
+// status of the latest export, with the download link once it's ready
+func (h *Handler) handleGetExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.latestExport(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if export == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no export requested yet"))
+		return
+	}
+
+	res := map[string]any{"export": export}
+	if export.Status == types.DataExportReady && time.Now().Before(*export.ExpiresAt) {
+		token, err := auth.CreateDataExportToken(export)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		res["downloadURL"] = fmt.Sprintf("%s/api/v1/me/export/%d/download?token=%s", config.Envs.AppURL, export.ID, token)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, res)
+}
+
+/* The latest export of the user, nil when there is none.
+*	a restart stops the job of a pending export for good, after exportTimeout it counts as failed
+*	so the user can ask for a new one
+ */
+func (h *Handler) latestExport(userID int) (*types.DataExport, error) {
+	export, err := h.store.GetLatestExportByUserID(userID)
+	if err != nil || export == nil {
+		return export, err
+	}
+	if export.Status == types.DataExportPending && time.Since(export.CreatedAt) > exportTimeout {
+		if err := h.store.FailExport(export.ID); err != nil {
+			return nil, err
+		}
+		export.Status = types.DataExportFailed
+	}
+	return export, nil
+}
+
+func (h *Handler) handleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := strconv.Atoi(mux.Vars(r)["exportID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid export id"))
+		return
+	}
+
+	claims, err := auth.ValidateDataExportToken(r.URL.Query().Get("token"))
+	if err != nil || claims.ExportID != exportID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("invalid or expired download link"))
+		return
+	}
+
+	export, err := h.store.GetExportByID(exportID)
+	if err != nil || export.Status != types.DataExportReady || time.Now().After(*export.ExpiresAt) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("export not found"))
+		return
+	}
+	// deleted accounts keep their export rows, but not the right to download them
+	if u, err := h.userStore.GetUserByID(export.UserID); err != nil || u.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("export not found"))
+		return
+	}
+
+	f, err := os.Open(export.FilePath)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("export not found"))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export-%d.zip"`, config.Envs.AppName, export.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", *export.CompletedAt, f)
+}
@@ -0,0 +1,245 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestDataExportHandler(t *testing.T) {
+	config.Envs.DataExportDir = t.TempDir()
+	store := &mockExportStore{}
+	userStore := &mockUserStore{user: types.User{ID: 1, FirstName: "user", Email: "user@example.com", Password: "hash"}}
+	orderStore := &mockOrderStore{}
+	handler := NewHandler(store, userStore, orderStore, &mockAddressStore{}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/me/export", handler.handleRequestExport).Methods(http.MethodPost)
+	router.HandleFunc("/me/export", handler.handleGetExport).Methods(http.MethodGet)
+	router.HandleFunc("/me/export/{exportID}/download", handler.handleDownloadExport).Methods(http.MethodGet)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should not find an export before one was requested", func(t *testing.T) {
+		if rr := serve(http.MethodGet, "/me/export"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	if rr := serve(http.MethodPost, "/me/export"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	handler.jobs.Wait()
+
+	rr := serve(http.MethodGet, "/me/export")
+	var res struct {
+		Export      types.DataExport `json:"export"`
+		DownloadURL string           `json:"downloadURL"`
+	}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.Export.Status != types.DataExportReady || res.DownloadURL == "" {
+		t.Fatalf("expected a ready export, got %d %+v", rr.Code, res)
+	}
+	download := strings.TrimPrefix(res.DownloadURL, config.Envs.AppURL+"/api/v1")
+
+	t.Run("should download the bundle with the link", func(t *testing.T) {
+		rr := serve(http.MethodGet, download)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := archive.Open("export.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(f)
+		var bundle types.DataExportBundle
+		json.Unmarshal(raw, &bundle)
+
+		if bundle.User.Email != "user@example.com" || len(bundle.Orders) != 2 || len(bundle.Orders[0].Items) != 1 {
+			t.Errorf("unexpected bundle %s", raw)
+		}
+		if len(bundle.Addresses) != 1 || len(bundle.AddressBook) != 1 || len(bundle.LoginHistory) != 1 {
+			t.Errorf("unexpected bundle %s", raw)
+		}
+		if strings.Contains(string(raw), "hash") {
+			t.Errorf("expected no password hash in the bundle")
+		}
+	})
+
+	t.Run("should reject a link of another export", func(t *testing.T) {
+		other := strings.Replace(download, fmt.Sprintf("/%d/", res.Export.ID), "/99/", 1)
+		if rr := serve(http.MethodGet, other); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject an expired export", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		store.exports[0].ExpiresAt = &expired
+		if rr := serve(http.MethodGet, download); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should start a new export when the pending one stopped with a restart", func(t *testing.T) {
+		stale := types.DataExport{ID: len(store.exports) + 1, UserID: 1, Status: types.DataExportPending, CreatedAt: time.Now().Add(-time.Hour)}
+		store.exports = append(store.exports, stale)
+
+		rr := serve(http.MethodPost, "/me/export")
+		handler.jobs.Wait()
+		var export types.DataExport
+		json.NewDecoder(rr.Body).Decode(&export)
+		if rr.Code != http.StatusAccepted || export.ID == stale.ID {
+			t.Fatalf("expected a new export, got %d %+v", rr.Code, export)
+		}
+		if status := store.exports[stale.ID-1].Status; status != types.DataExportFailed {
+			t.Errorf("expected the stale export to be failed, got %s", status)
+		}
+	})
+
+	t.Run("should not keep the file when the account was deleted during the export", func(t *testing.T) {
+		exportID, _ := store.CreateExport(1)
+		export, _ := store.GetExportByID(exportID)
+		store.DeleteUserExports(1)
+
+		handler.runExport(export)
+		files, _ := os.ReadDir(config.Envs.DataExportDir)
+		for _, f := range files {
+			if f.Name() == fmt.Sprintf("export-1-%d.zip", exportID) {
+				t.Errorf("expected %s to be removed", f.Name())
+			}
+		}
+	})
+}
+
+type mockExportStore struct {
+	exports []types.DataExport
+}
+
+func (m *mockExportStore) CreateExport(userID int) (int, error) {
+	id := len(m.exports) + 1
+	m.exports = append(m.exports, types.DataExport{ID: id, UserID: userID, Status: types.DataExportPending, CreatedAt: time.Now()})
+	return id, nil
+}
+
+func (m *mockExportStore) GetExportByID(id int) (*types.DataExport, error) {
+	for i := range m.exports {
+		if m.exports[i].ID == id {
+			export := m.exports[i]
+			return &export, nil
+		}
+	}
+	return nil, fmt.Errorf("export not found")
+}
+
+func (m *mockExportStore) GetLatestExportByUserID(userID int) (*types.DataExport, error) {
+	for i := len(m.exports) - 1; i >= 0; i-- {
+		if m.exports[i].UserID == userID {
+			export := m.exports[i]
+			return &export, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockExportStore) CompleteExport(id int, filePath string, expiresAt time.Time) error {
+	now := time.Now()
+	for i := range m.exports {
+		if m.exports[i].ID == id {
+			m.exports[i].Status = types.DataExportReady
+			m.exports[i].FilePath = filePath
+			m.exports[i].ExpiresAt = &expiresAt
+			m.exports[i].CompletedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockExportStore) FailExport(id int) error {
+	for i := range m.exports {
+		if m.exports[i].ID == id {
+			m.exports[i].Status = types.DataExportFailed
+		}
+	}
+	return nil
+}
+
+func (m *mockExportStore) RemoveExpiredExportFiles() (int, error) {
+	return 0, nil
+}
+
+func (m *mockExportStore) DeleteUserExports(userID int) error {
+	exports := make([]types.DataExport, 0)
+	for _, export := range m.exports {
+		if export.UserID != userID {
+			exports = append(exports, export)
+		}
+	}
+	m.exports = exports
+	return nil
+}
+
+type mockUserStore struct {
+	types.UserStore
+	user types.User
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	u := m.user
+	return &u, nil
+}
+
+func (m *mockUserStore) GetLoginAttempts(filter types.LoginAttemptFilter) ([]types.LoginAttempt, error) {
+	return []types.LoginAttempt{{ID: 1, UserID: filter.UserID, Success: true}}, nil
+}
+
+type mockOrderStore struct {
+	types.OrderStore
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int) ([]types.Order, error) {
+	return []types.Order{
+		{ID: 1, UserID: userID, Total: 10, Address: "street 1"},
+		{ID: 2, UserID: userID, Total: 20, Address: "street 1"},
+	}, nil
+}
+
+func (m *mockOrderStore) GetOrderItemsByOrderID(orderID int) ([]types.OrderItem, error) {
+	return []types.OrderItem{{ID: orderID, OrderID: orderID, ProductID: 1, Quantity: 1, Price: 10}}, nil
+}
+
+type mockAddressStore struct {
+	types.AddressStore
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	return []types.Address{{ID: 1, UserID: userID, PostalAddress: types.PostalAddress{Name: "user", Line1: "street 1", City: "city", Country: "NL"}}}, nil
+}
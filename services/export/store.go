@@ -0,0 +1,157 @@
+package export
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateExport(userID int) (int, error) {
+	res, err := s.db.Exec("INSERT INTO data_exports (userId, status) VALUES (?, ?)", userID, types.DataExportPending)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *Store) GetExportByID(id int) (*types.DataExport, error) {
+	rows, err := s.db.Query("SELECT * FROM data_exports WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export := new(types.DataExport)
+	for rows.Next() {
+		export, err = scanRowIntoExport(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if export.ID == 0 {
+		return nil, fmt.Errorf("export not found")
+	}
+
+	return export, nil
+}
+
+func (s *Store) GetLatestExportByUserID(userID int) (*types.DataExport, error) {
+	rows, err := s.db.Query("SELECT * FROM data_exports WHERE userId = ? ORDER BY id DESC LIMIT 1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		return scanRowIntoExport(rows)
+	}
+	return nil, nil
+}
+
+func (s *Store) CompleteExport(id int, filePath string, expiresAt time.Time) error {
+	_, err := s.db.Exec("UPDATE data_exports SET status = ?, filePath = ?, expiresAt = ?, completedAt = ? WHERE id = ?",
+		types.DataExportReady, filePath, expiresAt, time.Now(), id)
+	return err
+}
+
+func (s *Store) FailExport(id int) error {
+	_, err := s.db.Exec("UPDATE data_exports SET status = ?, completedAt = ? WHERE id = ?", types.DataExportFailed, time.Now(), id)
+	return err
+}
+
+// remove the files of ready exports past expiresAt, the rows stay without them
+func (s *Store) RemoveExpiredExportFiles() (int, error) {
+	paths, err := s.exportFiles("SELECT id, filePath FROM data_exports WHERE status = ? AND filePath <> '' AND expiresAt < ?", types.DataExportReady, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for id, path := range paths {
+		if err := removeExportFile(path); err != nil {
+			return 0, err
+		}
+		if _, err := s.db.Exec("UPDATE data_exports SET filePath = '' WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+	return len(paths), nil
+}
+
+// the files first, a row without its file is harmless but a file without its row is never removed
+func (s *Store) DeleteUserExports(userID int) error {
+	paths, err := s.exportFiles("SELECT id, filePath FROM data_exports WHERE userId = ? AND filePath <> ''", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := removeExportFile(path); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.Exec("DELETE FROM data_exports WHERE userId = ?", userID)
+	return err
+}
+
+// export id => file path
+func (s *Store) exportFiles(query string, args ...interface{}) (map[int]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		paths[id] = path
+	}
+	return paths, rows.Err()
+}
+
+// already gone is fine
+func removeExportFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func scanRowIntoExport(rows *sql.Rows) (*types.DataExport, error) {
+	export := new(types.DataExport)
+	err := rows.Scan(&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FilePath,
+		&export.ExpiresAt,
+		&export.CompletedAt,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
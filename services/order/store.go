@@ -2,6 +2,7 @@ package order
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/faldeus0092/go-ecom/types"
@@ -16,8 +17,54 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) CreateOrder(order types.Order) (int, error) {
-	res, err := s.db.Exec("insert into orders (userId, total, status, address) values (?, ?, ?, ?)", order.UserID, order.Total, order.Status, order.Address)
+/* Take the stock of the variants, create the order and its items in one transaction.
+*	the stock check and the update are one statement, so two checkouts can't both take the last one
+ */
+func (s *Store) PlaceOrder(order types.Order, items []types.OrderItem) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		res, err := tx.Exec("UPDATE product_variants SET quantity = quantity - ? WHERE id = ? AND quantity >= ?", item.Quantity, item.VariantID, item.Quantity)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if affected == 0 {
+			return 0, fmt.Errorf("%w for variant %d", types.ErrInsufficientStock, *item.VariantID)
+		}
+	}
+
+	orderID, err := insertOrder(tx, order)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		item.OrderID = orderID
+		if err := insertOrderItem(tx, item); err != nil {
+			return 0, err
+		}
+	}
+
+	return orderID, tx.Commit()
+}
+
+func insertOrder(tx *sql.Tx, order types.Order) (int, error) {
+	var shippingAddress []byte
+	if order.ShippingAddress != nil {
+		var err error
+		if shippingAddress, err = json.Marshal(order.ShippingAddress); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec("insert into orders (userId, guestCustomerId, total, status, address, shippingAddress) values (?, ?, ?, ?, ?, ?)",
+		nullableUserID(order.UserID), order.GuestCustomerID, order.Total, order.Status, order.Address, shippingAddress)
 	if err != nil {
 		return 0, err
 	}
@@ -28,16 +75,37 @@ func (s *Store) CreateOrder(order types.Order) (int, error) {
 	return int(id), nil
 }
 
-func (s *Store) CreateOrderItem(orderItem types.OrderItem) error {
-	_, err := s.db.Exec("insert into order_items (orderId, productId, quantity, price) values (?, ?, ?, ?)", orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price)
+func insertOrderItem(tx *sql.Tx, orderItem types.OrderItem) error {
+	_, err := tx.Exec("insert into order_items (orderId, productId, variantId, quantity, price) values (?, ?, ?, ?, ?)", orderItem.OrderID, orderItem.ProductID, orderItem.VariantID, orderItem.Quantity, orderItem.Price)
 	return err
 }
 
 func (s *Store) UpdateOrder(order types.Order) error {
-	_, err := s.db.Exec("update orders set userId = ?, total = ?, status = ?, address = ? where id = ?", order.UserID, order.Total, order.Status, order.Address, order.ID)
+	_, err := s.db.Exec("update orders set userId = ?, total = ?, status = ?, address = ? where id = ?", nullableUserID(order.UserID), order.Total, order.Status, order.Address, order.ID)
 	return err
 }
 
+// the same email always gets the same guest customer, LAST_INSERT_ID(id) hands back the existing one
+func (s *Store) CreateGuestCustomer(email string) (int, error) {
+	res, err := s.db.Exec("INSERT INTO guest_customers (email) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", email)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// guest orders have no user yet
+func nullableUserID(userID int) any {
+	if userID == 0 {
+		return nil
+	}
+	return userID
+}
+
 func (s *Store) GetOrdersByUserID(userID int) ([]types.Order, error) {
 	rows, err := s.db.Query("SELECT * FROM orders WHERE userId = ?", userID)
 	if err != nil {
@@ -74,18 +142,56 @@ func (s *Store) GetOrderByID(orderID int) (*types.Order, error){
 	return order, nil
 }
 
+func (s *Store) GetOrderItemsByOrderID(orderID int) ([]types.OrderItem, error) {
+	rows, err := s.db.Query("SELECT id, orderId, productId, variantId, quantity, price FROM order_items WHERE orderId = ?", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]types.OrderItem, 0)
+	for rows.Next() {
+		var item types.OrderItem
+		var variantID sql.NullInt64
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &variantID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			item.VariantID = &id
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 func scanRowIntoOrder(rows *sql.Rows) (*types.Order, error) {
 	order := new(types.Order)
+	var userID, guestCustomerID sql.NullInt64
+	var shippingAddress []byte
 	err := rows.Scan(&order.ID,
-		&order.UserID,
+		&userID,
 		&order.Total,
 		&order.Status,
 		&order.Address,
 		&order.CreatedAt,
+		&guestCustomerID,
+		&shippingAddress,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if shippingAddress != nil {
+		order.ShippingAddress = new(types.PostalAddress)
+		if err := json.Unmarshal(shippingAddress, order.ShippingAddress); err != nil {
+			return nil, err
+		}
+	}
+	order.UserID = int(userID.Int64)
+	if guestCustomerID.Valid {
+		id := int(guestCustomerID.Int64)
+		order.GuestCustomerID = &id
+	}
 
 	return order, nil
 }
@@ -0,0 +1,46 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+// what the opaque next cursor holds. the sort is in it so a cursor can't be used with another sort
+type cursor struct {
+	Sort string `json:"s"`
+	types.ProductCursor
+}
+
+func encodeCursor(sort string, last types.Product) (string, error) {
+	b, err := json.Marshal(cursor{
+		Sort: sort,
+		ProductCursor: types.ProductCursor{
+			ID: last.ID,
+			Price: last.Price,
+			Name: last.Name,
+			CreatedAt: last.CreatedAt,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(sort, encoded string) (*types.ProductCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != sort {
+		return nil, fmt.Errorf("cursor was made for sort %q", c.Sort)
+	}
+	return &c.ProductCursor, nil
+}
@@ -0,0 +1,43 @@
+package product
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+func TestCursor(t *testing.T) {
+	createdAt := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	last := types.Product{ID: 7, Name: "Desk lamp", Price: 19.5, CreatedAt: createdAt}
+
+	t.Run("should decode what it encoded", func(t *testing.T) {
+		encoded, err := encodeCursor(types.ProductSortPrice, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := decodeCursor(types.ProductSortPrice, encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ID != 7 || c.Name != "Desk lamp" || c.Price != 19.5 || !c.CreatedAt.Equal(createdAt) {
+			t.Errorf("unexpected cursor %+v", c)
+		}
+	})
+
+	t.Run("should refuse a cursor made for another sort", func(t *testing.T) {
+		encoded, _ := encodeCursor(types.ProductSortPrice, last)
+		if _, err := decodeCursor(types.ProductSortName, encoded); err == nil || err.Error() != `cursor was made for sort "price"` {
+			t.Errorf("expected the sort mismatch to be refused, got %v", err)
+		}
+	})
+
+	t.Run("should refuse a cursor that isn't one", func(t *testing.T) {
+		for _, encoded := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("{}")), base64.RawURLEncoding.EncodeToString([]byte("[1]"))} {
+			if _, err := decodeCursor(types.ProductSortNewest, encoded); err == nil {
+				t.Errorf("expected %q to be refused", encoded)
+			}
+		}
+	})
+}
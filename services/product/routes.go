@@ -3,7 +3,12 @@ package product
 import (
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/faldeus0092/go-ecom/services/auth"
 	"github.com/faldeus0092/go-ecom/types"
 	"github.com/faldeus0092/go-ecom/utils"
 	"github.com/go-playground/validator/v10"
@@ -12,25 +17,207 @@ import (
 
 type Handler struct {
 	store types.ProductStore
+	variantStore types.VariantStore
+	searchIndex types.SearchIndex
+	categoryStore types.CategoryStore
+	userStore types.UserStore
+	sessionStore types.SessionStore
+	apiKeyStore types.APIKeyStore
 }
 
-func NewHandler(store types.ProductStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.ProductStore, variantStore types.VariantStore, searchIndex types.SearchIndex, categoryStore types.CategoryStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore) *Handler {
+	return &Handler{store: store, variantStore: variantStore, searchIndex: searchIndex, categoryStore: categoryStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router)  {
 	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
-	router.HandleFunc("/products", h.handleCreateProduct).Methods(http.MethodPost)
+	// before {productID}, it would match "search" too
+	router.HandleFunc("/products/search", h.handleSearchProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}", h.handleGetProduct).Methods(http.MethodGet)
+	router.HandleFunc("/categories/{slug}/products", h.handleGetCategoryProducts).Methods(http.MethodGet)
+	// catalog writes are for staff and admins only, or API keys with products:write
+	router.HandleFunc("/products", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleCreateProduct, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleUpdateProduct, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handlePatchProduct, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPatch)
+	router.HandleFunc("/products/{productID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleDeleteProduct, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/products/{productID}/variants", h.handleGetVariants).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}/options", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleSetOptions, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}/variants", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleCreateVariant, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}/variants/{variantID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handlePatchVariant, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodPatch)
+	router.HandleFunc("/products/{productID}/variants/{variantID}", auth.WithJWTOrAPIKey(auth.WithScopeOrRole(h.handleDeleteVariant, types.ScopeProductsWrite, types.RoleStaff, types.RoleAdmin), h.userStore, h.sessionStore, h.apiKeyStore)).Methods(http.MethodDelete)
+}
+
+const (
+	defaultProductsLimit = 20
+	maxProductsLimit     = 100
+	maxSearchQueryLength = 200
+)
+
+var productSorts = []string{
+	types.ProductSortNewest, types.ProductSortOldest,
+	types.ProductSortPrice, types.ProductSortPriceDesc,
+	types.ProductSortName, types.ProductSortNameDesc,
 }
 
+/* GET /products?sort=&minPrice=&maxPrice=&inStock=&createdAfter=&limit=&cursor=
+*	the next page is fetched by sending back the "next" cursor with the same sort and filters
+ */
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.store.GetProducts()
+	query, err := parseProductQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.writeProducts(w, query)
+}
+
+// like GET /products, with the products of the subcategories too
+func (h *Handler) handleGetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	query, err := parseProductQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	slug := mux.Vars(r)["slug"]
+	c, err := h.categoryStore.GetCategoryBySlug(slug)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("category %s not found", slug))
+		return
+	}
+	query.CategoryIDs, err = h.categoryStore.GetDescendantCategoryIDs(c.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeProducts(w, query)
+}
+
+// a page of products in the listing envelope
+func (h *Handler) writeProducts(w http.ResponseWriter, query types.ProductQuery) {
+	// one more than asked for, to know if there's a next page
+	limit := query.Limit
+	query.Limit++
+	products, err := h.store.GetProducts(query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var next string
+	hasMore := len(products) > limit
+	if hasMore {
+		products = products[:limit]
+		next, err = encodeCursor(query.Sort, products[limit-1])
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"products": products,
+		"next": next,
+		"hasMore": hasMore,
+		"limit": limit,
+		"sort": query.Sort,
+	})
+}
+
+// GET /products/search?q=&limit=, best matches first with the matches highlighted
+func (h *Handler) handleSearchProducts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || len(q) > maxSearchQueryLength {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q must be 1 to %d characters", maxSearchQueryLength))
+		return
+	}
+	limit := defaultProductsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxProductsLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxProductsLimit))
+			return
+		}
+		limit = l
+	}
+
+	results, err := h.searchIndex.Search(q, limit)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, products)
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"query": q,
+		"results": results,
+	})
+}
+
+func parseProductQuery(r *http.Request) (types.ProductQuery, error) {
+	values := r.URL.Query()
+	query := types.ProductQuery{
+		Sort: types.ProductSortNewest,
+		Limit: defaultProductsLimit,
+	}
+
+	if v := values.Get("sort"); v != "" {
+		if !slices.Contains(productSorts, v) {
+			return query, fmt.Errorf("sort must be one of %s", strings.Join(productSorts, ", "))
+		}
+		query.Sort = v
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxProductsLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxProductsLimit)
+		}
+		query.Limit = limit
+	}
+	for param, field := range map[string]**float64{"minPrice": &query.MinPrice, "maxPrice": &query.MaxPrice} {
+		if v := values.Get(param); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil || price < 0 {
+				return query, fmt.Errorf("%s must be a positive number", param)
+			}
+			*field = &price
+		}
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return query, fmt.Errorf("minPrice can't be above maxPrice")
+	}
+	if v := values.Get("inStock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("inStock must be true or false")
+		}
+		query.InStock = inStock
+	}
+	if v := values.Get("createdAfter"); v != "" {
+		createdAfter, err := parseTimeParam(v)
+		if err != nil {
+			return query, fmt.Errorf("createdAfter must be a date (2006-01-02) or RFC 3339 time")
+		}
+		query.CreatedAfter = &createdAfter
+	}
+	if v := values.Get("cursor"); v != "" {
+		after, err := decodeCursor(query.Sort, v)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	return query, nil
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
 }
 
 func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
@@ -49,18 +236,163 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if payload.SKU != "" {
+		if _, err := h.variantStore.GetVariantBySKU(payload.SKU); err == nil {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("sku %s is already taken", payload.SKU))
+			return
+		}
+	}
+
 	// create on DB
-	err := h.store.CreateProduct(types.Product{
+	productID, err := h.store.CreateProduct(types.Product{
 		Name: payload.Name,
 		Description: payload.Description,
 		Image: payload.Image,
 		Price: payload.Price,
 		Quantity: payload.Quantity,
+		Variants: []types.Variant{{SKU: payload.SKU, Quantity: payload.Quantity}},
 	})
 
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusCreated, nil)
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, product)
+}
+
+// with its option types and variants
+func (h *Handler) handleGetProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	product.Options, err = h.variantStore.GetOptions(product.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	product.Variants, err = h.variantStore.GetVariantsByProductIDs([]int{product.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+// replaces every field of the product
+func (h *Handler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	var payload types.UpdateProductPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	product.Name = payload.Name
+	product.Description = payload.Description
+	product.Image = payload.Image
+	product.Price = payload.Price
+	if err := h.store.UpdateProduct(*product); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+// only changes the fields sent, e.g. {"price": 9.99}
+func (h *Handler) handlePatchProduct(w http.ResponseWriter, r *http.Request) {
+	var payload types.PatchProductPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	if payload.Name != nil {
+		product.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		product.Description = *payload.Description
+	}
+	if payload.Image != nil {
+		product.Image = *payload.Image
+	}
+	if payload.Price != nil {
+		product.Price = *payload.Price
+	}
+	if err := h.store.UpdateProduct(*product); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+/* Soft delete the product.
+*	it's gone from the catalog and checkout, past orders keep pointing to it
+ */
+func (h *Handler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteProduct(product.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "product deleted"})
+}
+
+// the product from the {productID} path, deleted ones are not found
+func (h *Handler) activeProduct(w http.ResponseWriter, r *http.Request) (*types.Product, bool) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product id"))
+		return nil, false
+	}
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil || product.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with id %d not found", productID))
+		return nil, false
+	}
+	return product, true
 }
\ No newline at end of file
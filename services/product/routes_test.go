@@ -0,0 +1,331 @@
+package product
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestProductHandler(t *testing.T) {
+	store := &mockProductStore{}
+	handler := NewHandler(store, &mockVariantStore{}, nil, nil, nil, nil, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products", handler.handleCreateProduct).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}", handler.handleGetProduct).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}", handler.handleUpdateProduct).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}", handler.handlePatchProduct).Methods(http.MethodPatch)
+	router.HandleFunc("/products/{productID}", handler.handleDeleteProduct).Methods(http.MethodDelete)
+
+	serve := func(method, path string, payload any) (*httptest.ResponseRecorder, types.Product) {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var product types.Product
+		json.Unmarshal(rr.Body.Bytes(), &product)
+		return rr, product
+	}
+	str := func(s string) *string { return &s }
+	price := func(p float64) *float64 { return &p }
+
+	for _, name := range []string{"Desk lamp", "Office chair"} {
+		payload := types.CreateProductPayload{Name: name, Description: "for the office", Image: "lamp.jpg", Price: 20, Quantity: 5}
+		if rr, _ := serve(http.MethodPost, "/products", payload); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	}
+
+	t.Run("should answer a create with the new product", func(t *testing.T) {
+		payload := types.CreateProductPayload{Name: "Bookshelf", Description: "oak", Image: "shelf.jpg", Price: 80, Quantity: 2}
+		rr, product := serve(http.MethodPost, "/products", payload)
+		if rr.Code != http.StatusCreated || product.ID != 3 || product.Name != "Bookshelf" || product.Quantity != 2 {
+			t.Errorf("unexpected response %d %+v", rr.Code, product)
+		}
+	})
+
+	t.Run("should fail to create a product with an invalid payload", func(t *testing.T) {
+		if rr, _ := serve(http.MethodPost, "/products", types.CreateProductPayload{Name: "no price"}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should get a product with its variants", func(t *testing.T) {
+		rr, product := serve(http.MethodGet, "/products/1", nil)
+		if rr.Code != http.StatusOK || product.Name != "Desk lamp" || len(product.Variants) != 1 {
+			t.Errorf("unexpected response %d %+v", rr.Code, product)
+		}
+		if rr, _ := serve(http.MethodGet, "/products/99", nil); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if rr, _ := serve(http.MethodGet, "/products/abc", nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should replace every field with PUT", func(t *testing.T) {
+		payload := types.UpdateProductPayload{Name: "Floor lamp", Description: "tall", Image: "floor.jpg", Price: 45}
+		rr, _ := serve(http.MethodPut, "/products/1", payload)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if p := store.products[0]; p.Name != "Floor lamp" || p.Description != "tall" || p.Image != "floor.jpg" || p.Price != 45 {
+			t.Errorf("unexpected product %+v", p)
+		}
+		if rr, _ := serve(http.MethodPut, "/products/1", types.UpdateProductPayload{Name: "Floor lamp"}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a PUT without every field to be refused, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should only change the fields sent with PATCH", func(t *testing.T) {
+		rr, _ := serve(http.MethodPatch, "/products/1", types.PatchProductPayload{Price: price(39.5)})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if p := store.products[0]; p.Price != 39.5 || p.Name != "Floor lamp" {
+			t.Errorf("unexpected product %+v", p)
+		}
+		if rr, _ := serve(http.MethodPatch, "/products/1", types.PatchProductPayload{Name: str("")}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected an empty name to be refused, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should soft delete a product", func(t *testing.T) {
+		if rr, _ := serve(http.MethodDelete, "/products/2", nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.products[1].DeletedAt == nil {
+			t.Fatalf("expected the product to be kept with deletedAt set")
+		}
+		for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+			if rr, _ := serve(method, "/products/2", types.PatchProductPayload{}); rr.Code != http.StatusNotFound {
+				t.Errorf("expected status code %d for %s, got %d", http.StatusNotFound, method, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should leave deleted products out of the listing", func(t *testing.T) {
+		rr, _ := serve(http.MethodGet, "/products", nil)
+		var res struct {
+			Products []types.Product `json:"products"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		for _, p := range res.Products {
+			if p.ID == 2 {
+				t.Errorf("expected the deleted product to be left out, got %+v", res.Products)
+			}
+		}
+		if len(res.Products) != 2 {
+			t.Errorf("expected 2 products, got %+v", res.Products)
+		}
+	})
+}
+
+// in memory ProductStore, the listing keeps to the store's sort and paging
+type mockProductStore struct {
+	products []types.Product
+}
+
+func (m *mockProductStore) GetProducts(query types.ProductQuery) ([]types.Product, error) {
+	products := make([]types.Product, 0)
+	for i := len(m.products) - 1; i >= 0; i-- {
+		p := m.products[i]
+		if p.DeletedAt != nil || (query.After != nil && p.ID >= query.After.ID) {
+			continue
+		}
+		products = append(products, p)
+	}
+	if len(products) > query.Limit {
+		products = products[:query.Limit]
+	}
+	return products, nil
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
+	for _, p := range m.products {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("product not found")
+}
+
+func (m *mockProductStore) GetProductsByIDs(ids []int) ([]types.Product, error) {
+	products := make([]types.Product, 0)
+	for _, id := range ids {
+		if p, err := m.GetProductByID(id); err == nil {
+			products = append(products, *p)
+		}
+	}
+	return products, nil
+}
+
+func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
+	product.ID = len(m.products) + 1
+	// ids follow the creation order
+	product.CreatedAt = time.Now().Add(time.Duration(product.ID) * time.Second)
+	product.Variants = nil
+	m.products = append(m.products, product)
+	return product.ID, nil
+}
+
+func (m *mockProductStore) UpdateProduct(product types.Product) error {
+	m.products[product.ID-1] = product
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int) error {
+	now := time.Now()
+	m.products[id-1].DeletedAt = &now
+	return nil
+}
+
+// every product has just its default variant
+type mockVariantStore struct {
+	types.VariantStore
+}
+
+func (m *mockVariantStore) GetOptions(productID int) ([]types.ProductOption, error) {
+	return []types.ProductOption{}, nil
+}
+
+func (m *mockVariantStore) GetVariantsByProductIDs(productIDs []int) ([]types.Variant, error) {
+	variants := make([]types.Variant, len(productIDs))
+	for i, id := range productIDs {
+		variants[i] = types.Variant{ID: id, ProductID: id, SKU: fmt.Sprintf("P%d", id), IsDefault: true}
+	}
+	return variants, nil
+}
+
+func (m *mockVariantStore) GetVariantBySKU(sku string) (*types.Variant, error) {
+	return nil, fmt.Errorf("variant not found")
+}
+
+func TestParseProductQuery(t *testing.T) {
+	parse := func(rawQuery string) (types.ProductQuery, error) {
+		req, err := http.NewRequest(http.MethodGet, "/products?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseProductQuery(req)
+	}
+
+	t.Run("should default to the newest 20", func(t *testing.T) {
+		query, err := parse("")
+		if err != nil || query.Sort != types.ProductSortNewest || query.Limit != defaultProductsLimit {
+			t.Errorf("unexpected query %+v %v", query, err)
+		}
+	})
+
+	t.Run("should parse the filters", func(t *testing.T) {
+		query, err := parse("sort=price&limit=5&minPrice=10&maxPrice=20.5&inStock=true&createdAfter=2024-08-01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Sort != types.ProductSortPrice || query.Limit != 5 || *query.MinPrice != 10 || *query.MaxPrice != 20.5 || !query.InStock {
+			t.Errorf("unexpected query %+v", query)
+		}
+		if query.CreatedAfter == nil || !query.CreatedAfter.Equal(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected createdAfter %v", query.CreatedAfter)
+		}
+	})
+
+	t.Run("should refuse invalid parameters", func(t *testing.T) {
+		for _, rawQuery := range []string{
+			"sort=color",
+			"limit=0",
+			"limit=101",
+			"limit=ten",
+			"minPrice=-1",
+			"maxPrice=cheap",
+			"minPrice=20&maxPrice=10",
+			"inStock=maybe",
+			"createdAfter=yesterday",
+			"cursor=garbage",
+		} {
+			if _, err := parse(rawQuery); err == nil {
+				t.Errorf("expected %s to be refused", rawQuery)
+			}
+		}
+	})
+
+	t.Run("should refuse a cursor of another sort", func(t *testing.T) {
+		encoded, _ := encodeCursor(types.ProductSortName, types.Product{ID: 1, Name: "Desk lamp"})
+		if _, err := parse("sort=name&cursor=" + encoded); err != nil {
+			t.Errorf("expected the cursor to be accepted, got %v", err)
+		}
+		if _, err := parse("sort=price&cursor=" + encoded); err == nil {
+			t.Errorf("expected the cursor to be refused for another sort")
+		}
+	})
+}
+
+func TestProductListing(t *testing.T) {
+	store := &mockProductStore{}
+	for i := 1; i <= 5; i++ {
+		store.CreateProduct(types.Product{Name: fmt.Sprintf("Product %d", i)})
+	}
+	handler := NewHandler(store, &mockVariantStore{}, nil, nil, nil, nil, nil)
+
+	type page struct {
+		Products []types.Product `json:"products"`
+		Next     string          `json:"next"`
+		HasMore  bool            `json:"hasMore"`
+		Limit    int             `json:"limit"`
+		Sort     string          `json:"sort"`
+	}
+	get := func(rawQuery string) page {
+		req, err := http.NewRequest(http.MethodGet, "/products?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.handleGetProducts(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var p page
+		json.Unmarshal(rr.Body.Bytes(), &p)
+		return p
+	}
+	ids := func(products []types.Product) string {
+		found := make([]int, len(products))
+		for i, p := range products {
+			found[i] = p.ID
+		}
+		return fmt.Sprint(found)
+	}
+
+	t.Run("should page through the products with the next cursor", func(t *testing.T) {
+		first := get("limit=2")
+		if ids(first.Products) != "[5 4]" || !first.HasMore || first.Next == "" || first.Limit != 2 || first.Sort != types.ProductSortNewest {
+			t.Fatalf("unexpected first page %+v", first)
+		}
+		second := get("limit=2&cursor=" + first.Next)
+		if ids(second.Products) != "[3 2]" || !second.HasMore {
+			t.Fatalf("unexpected second page %+v", second)
+		}
+		last := get("limit=2&cursor=" + second.Next)
+		if ids(last.Products) != "[1]" || last.HasMore || last.Next != "" {
+			t.Errorf("unexpected last page %+v", last)
+		}
+	})
+
+	t.Run("should not have more when the page is exactly full", func(t *testing.T) {
+		if p := get("limit=5"); len(p.Products) != 5 || p.HasMore || p.Next != "" {
+			t.Errorf("unexpected page %+v", p)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package product
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -17,11 +18,79 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetProducts() ([]types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products")
+// the stock of a product is what its variants have left together
+const selectProducts = `SELECT id, name, description, image, price,
+	(SELECT COALESCE(SUM(v.quantity), 0) FROM product_variants v WHERE v.productId = products.id AND v.deletedAt IS NULL),
+	createdAt, deletedAt
+	FROM products`
+
+// columns to sort by, keyed by types.ProductSort without the "-"
+var productSortColumns = map[string]string{
+	"createdAt": "createdAt",
+	"price": "price",
+	"name": "name",
+}
+
+/* Up to query.Limit products, soft deleted ones are left out.
+*	pages continue after query.After instead of using an offset, so they stay cheap
+*	and don't skip or repeat products when the catalog changes in between
+ */
+func (s *Store) GetProducts(query types.ProductQuery) ([]types.Product, error) {
+	sortKey, desc := strings.TrimPrefix(query.Sort, "-"), strings.HasPrefix(query.Sort, "-")
+	column, ok := productSortColumns[sortKey]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort %q", query.Sort)
+	}
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	conditions := []string{"deletedAt IS NULL"}
+	args := []interface{}{}
+	if query.MinPrice != nil {
+		conditions = append(conditions, "price >= ?")
+		args = append(args, *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		conditions = append(conditions, "price <= ?")
+		args = append(args, *query.MaxPrice)
+	}
+	if query.InStock {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM product_variants v WHERE v.productId = products.id AND v.deletedAt IS NULL AND v.quantity > 0)")
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "createdAt > ?")
+		args = append(args, *query.CreatedAfter)
+	}
+	if len(query.CategoryIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("id IN (SELECT productId FROM product_categories WHERE categoryId IN (?%s))", strings.Repeat(",?", len(query.CategoryIDs)-1)))
+		for _, categoryID := range query.CategoryIDs {
+			args = append(args, categoryID)
+		}
+	}
+	if query.After != nil {
+		var value interface{}
+		switch sortKey {
+		case "price":
+			value = query.After.Price
+		case "name":
+			value = query.After.Name
+		default:
+			value = query.After.CreatedAt
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, cmp))
+		args = append(args, value, value, query.After.ID)
+	}
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query(fmt.Sprintf("%s WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		selectProducts, strings.Join(conditions, " AND "), column, direction, direction), args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
 	products := make([]types.Product, 0)
 	for rows.Next() {
 		p, err := scanRowIntoProduct(rows)
@@ -43,6 +112,7 @@ func scanRowIntoProduct(rows *sql.Rows) (*types.Product, error) {
 		&product.Price,
 		&product.Quantity,
 		&product.CreatedAt,
+		&product.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -51,20 +121,72 @@ func scanRowIntoProduct(rows *sql.Rows) (*types.Product, error) {
 	return product, nil
 }
 
-func (s *Store) CreateProduct(product types.Product) error {
-	_, err := s.db.Exec("insert into products (name, description, image, price, quantity) values (?, ?, ?, ?, ?)", product.Name, product.Description, product.Image, product.Price, product.Quantity)
+/* The product with that id, soft deleted or not.
+*	callers showing the catalog have to check DeletedAt
+ */
+func (s *Store) GetProductByID(id int) (*types.Product, error) {
+	rows, err := s.db.Query(selectProducts+" WHERE id = ?", id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	product := new(types.Product)
+	for rows.Next() {
+		product, err = scanRowIntoProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if product.ID == 0 {
+		return nil, fmt.Errorf("product not found")
+	}
+	return product, nil
+}
+
+// the product and its default variant, in one transaction
+func (s *Store) CreateProduct(product types.Product) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("insert into products (name, description, image, price) values (?, ?, ?, ?)", product.Name, product.Description, product.Image, product.Price)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	variant := types.Variant{Quantity: product.Quantity}
+	if len(product.Variants) > 0 {
+		variant = product.Variants[0]
+	}
+	variant.ProductID = int(id)
+	variant.IsDefault = true
+	if variant.SKU == "" {
+		variant.SKU = fmt.Sprintf("P%d", id)
+	}
+	if _, err := insertVariant(tx, variant); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
 }
 
 /*Accept an array of productIDs and returns an array of types.Product corresponding to the productIDs
  */
 func (s *Store) GetProductsByIDs(productIDs []int) ([]types.Product, error) {
+	if len(productIDs) == 0 {
+		return []types.Product{}, nil
+	}
 	// build query. appending ,? to already formatted ?%s
 	placeholders := strings.Repeat(",?", len(productIDs)-1)
-	query := fmt.Sprintf("select * from products where id in (?%s)", placeholders)
+	query := fmt.Sprintf("%s where id in (?%s)", selectProducts, placeholders)
 	
 	args := make([]interface{}, len(productIDs))
 	for i, v := range productIDs {
@@ -91,11 +213,229 @@ func (s *Store) GetProductsByIDs(productIDs []int) ([]types.Product, error) {
 }
 
 /* Update product based on types.Product received
+*	the stock is on the variants, Quantity is ignored
  */
 func (s *Store) UpdateProduct(product types.Product) error {
-	_, err := s.db.Exec("update products set name =?, price=?, image=?, description=?, quantity=? where id=?", product.Name, product.Price, product.Image, product.Description, product.Quantity, product.ID)
+	_, err := s.db.Exec("update products set name =?, price=?, image=?, description=? where id=?", product.Name, product.Price, product.Image, product.Description, product.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+/* Soft delete, the row stays for the order items pointing to it.
+*	it's gone from the listing and can't be bought anymore
+ */
+func (s *Store) DeleteProduct(id int) error {
+	_, err := s.db.Exec("update products set deletedAt = NOW() where id = ? and deletedAt is null", id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func (s *Store) GetOptions(productID int) ([]types.ProductOption, error) {
+	rows, err := s.db.Query("SELECT id, productId, name, position FROM product_options WHERE productId = ? ORDER BY position", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := make([]types.ProductOption, 0)
+	for rows.Next() {
+		var o types.ProductOption
+		if err := rows.Scan(&o.ID, &o.ProductID, &o.Name, &o.Position); err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+	return options, nil
+}
+
+func (s *Store) SetOptions(productID int, names []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM product_options WHERE productId = ?", productID); err != nil {
+		return err
+	}
+	for i, name := range names {
+		if _, err := tx.Exec("INSERT INTO product_options (productId, name, position) VALUES (?, ?, ?)", productID, name, i); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const selectVariants = "SELECT id, productId, sku, options, price, quantity, image, isDefault, createdAt, deletedAt FROM product_variants"
+
+func (s *Store) GetVariantsByProductIDs(productIDs []int) ([]types.Variant, error) {
+	if len(productIDs) == 0 {
+		return []types.Variant{}, nil
+	}
+	args := make([]interface{}, len(productIDs))
+	for i, v := range productIDs {
+		args[i] = v
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf("%s WHERE productId IN (?%s) AND deletedAt IS NULL ORDER BY productId, isDefault DESC, id",
+		selectVariants, strings.Repeat(",?", len(productIDs)-1)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make([]types.Variant, 0)
+	for rows.Next() {
+		v, err := scanRowIntoVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, *v)
+	}
+	return variants, nil
+}
+
+// soft deleted or not, like GetProductByID
+func (s *Store) GetVariantByID(id int) (*types.Variant, error) {
+	return s.getVariant(selectVariants+" WHERE id = ?", id)
+}
+
+func (s *Store) GetVariantBySKU(sku string) (*types.Variant, error) {
+	return s.getVariant(selectVariants+" WHERE sku = ?", sku)
+}
+
+func (s *Store) getVariant(query string, args ...interface{}) (*types.Variant, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	v := new(types.Variant)
+	for rows.Next() {
+		v, err = scanRowIntoVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if v.ID == 0 {
+		return nil, fmt.Errorf("variant not found")
+	}
+	return v, nil
+}
+
+func (s *Store) CreateVariant(v types.Variant) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if v.IsDefault {
+		if err := clearDefaultVariant(tx, v); err != nil {
+			return 0, err
+		}
+	}
+	id, err := insertVariant(tx, v)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (s *Store) UpdateVariant(v types.Variant) error {
+	if v.Options == nil {
+		v.Options = map[string]string{}
+	}
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if v.IsDefault {
+		if err := clearDefaultVariant(tx, v); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("UPDATE product_variants SET sku = ?, options = ?, price = ?, quantity = ?, image = ?, isDefault = ? WHERE id = ?",
+		v.SKU, options, v.Price, v.Quantity, v.Image, v.IsDefault, v.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// soft delete, order items keep pointing to it
+func (s *Store) DeleteVariant(id int) error {
+	_, err := s.db.Exec("UPDATE product_variants SET deletedAt = NOW(), isDefault = FALSE WHERE id = ? AND deletedAt IS NULL", id)
+	return err
+}
+
+func insertVariant(tx *sql.Tx, v types.Variant) (int, error) {
+	if v.Options == nil {
+		v.Options = map[string]string{}
+	}
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("INSERT INTO product_variants (productId, sku, options, price, quantity, image, isDefault) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		v.ProductID, v.SKU, options, v.Price, v.Quantity, v.Image, v.IsDefault)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// a product has one default variant
+func clearDefaultVariant(tx *sql.Tx, v types.Variant) error {
+	_, err := tx.Exec("UPDATE product_variants SET isDefault = FALSE WHERE productId = ? AND id <> ?", v.ProductID, v.ID)
+	return err
+}
+
+func scanRowIntoVariant(rows *sql.Rows) (*types.Variant, error) {
+	v := new(types.Variant)
+	var options []byte
+	var price sql.NullFloat64
+	err := rows.Scan(&v.ID,
+		&v.ProductID,
+		&v.SKU,
+		&options,
+		&price,
+		&v.Quantity,
+		&v.Image,
+		&v.IsDefault,
+		&v.CreatedAt,
+		&v.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(options, &v.Options); err != nil {
+		return nil, err
+	}
+	if price.Valid {
+		v.Price = &price.Float64
+	}
+	return v, nil
+}
@@ -0,0 +1,274 @@
+package product
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// the option types of the product and its variants, default first
+func (h *Handler) handleGetVariants(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	options, err := h.variantStore.GetOptions(product.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	variants, err := h.variantStore.GetVariantsByProductIDs([]int{product.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"options": options,
+		"variants": variants,
+	})
+}
+
+// replaces the option types, e.g. {"options": ["size", "color"]}. options still used by a variant can't go
+func (h *Handler) handleSetOptions(w http.ResponseWriter, r *http.Request) {
+	var payload types.ProductOptionsPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	names := make(map[string]bool)
+	for _, name := range payload.Options {
+		if names[name] {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("option %s is listed twice", name))
+			return
+		}
+		names[name] = true
+	}
+	variants, err := h.variantStore.GetVariantsByProductIDs([]int{product.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, v := range variants {
+		for name := range v.Options {
+			if !names[name] {
+				utils.WriteError(w, http.StatusConflict, fmt.Errorf("option %s is still used by variant %s", name, v.SKU))
+				return
+			}
+		}
+	}
+
+	if err := h.variantStore.SetOptions(product.ID, payload.Options); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.handleGetVariants(w, r)
+}
+
+func (h *Handler) handleCreateVariant(w http.ResponseWriter, r *http.Request) {
+	var payload types.CreateVariantPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return
+	}
+
+	v := types.Variant{
+		ProductID: product.ID,
+		SKU: payload.SKU,
+		Options: payload.Options,
+		Price: payload.Price,
+		Quantity: payload.Quantity,
+		Image: payload.Image,
+		IsDefault: payload.IsDefault,
+	}
+	if !h.checkVariant(w, v) {
+		return
+	}
+
+	variantID, err := h.variantStore.CreateVariant(v)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	created, err := h.variantStore.GetVariantByID(variantID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+// only changes the fields sent, e.g. {"quantity": 10} to restock
+func (h *Handler) handlePatchVariant(w http.ResponseWriter, r *http.Request) {
+	var payload types.PatchVariantPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil{
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate
+	if err := utils.Validate.Struct(payload); err != nil{
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	v, ok := h.pathVariant(w, r)
+	if !ok {
+		return
+	}
+
+	if payload.SKU != nil {
+		v.SKU = *payload.SKU
+	}
+	if payload.Options != nil {
+		v.Options = *payload.Options
+	}
+	if payload.Price != nil {
+		v.Price = payload.Price
+	}
+	if payload.ClearPrice {
+		v.Price = nil
+	}
+	if payload.Quantity != nil {
+		v.Quantity = *payload.Quantity
+	}
+	if payload.Image != nil {
+		v.Image = *payload.Image
+	}
+	if payload.IsDefault != nil {
+		// the default only moves by making another variant the default
+		if v.IsDefault && !*payload.IsDefault {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("make another variant the default instead"))
+			return
+		}
+		v.IsDefault = *payload.IsDefault
+	}
+	if !h.checkVariant(w, *v) {
+		return
+	}
+
+	if err := h.variantStore.UpdateVariant(*v); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, v)
+}
+
+// soft delete, past order items still point to it. the default variant stays
+func (h *Handler) handleDeleteVariant(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.pathVariant(w, r)
+	if !ok {
+		return
+	}
+	if v.IsDefault {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("the default variant can't be deleted, make another variant the default first"))
+		return
+	}
+
+	if err := h.variantStore.DeleteVariant(v.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "variant deleted"})
+}
+
+/* The sku has to be free, the options have to be option types of the product
+*	and no other variant can have the same ones
+ */
+func (h *Handler) checkVariant(w http.ResponseWriter, v types.Variant) bool {
+	if existing, err := h.variantStore.GetVariantBySKU(v.SKU); err == nil && existing.ID != v.ID {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("sku %s is already taken", v.SKU))
+		return false
+	}
+
+	options, err := h.variantStore.GetOptions(v.ProductID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	known := make(map[string]bool)
+	for _, o := range options {
+		known[o.Name] = true
+	}
+	for name := range v.Options {
+		if !known[name] {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product has no option %s, add it with PUT /products/%d/options first", name, v.ProductID))
+			return false
+		}
+	}
+
+	variants, err := h.variantStore.GetVariantsByProductIDs([]int{v.ProductID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	for _, other := range variants {
+		if other.ID != v.ID && maps.Equal(other.Options, v.Options) {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("variant %s already has these options", other.SKU))
+			return false
+		}
+	}
+	return true
+}
+
+// the variant from the path, it has to belong to the product. deleted ones are not found
+func (h *Handler) pathVariant(w http.ResponseWriter, r *http.Request) (*types.Variant, bool) {
+	product, ok := h.activeProduct(w, r)
+	if !ok {
+		return nil, false
+	}
+	variantID, err := strconv.Atoi(mux.Vars(r)["variantID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid variant id"))
+		return nil, false
+	}
+
+	v, err := h.variantStore.GetVariantByID(variantID)
+	if err != nil || v.ProductID != product.ID || v.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("variant with id %d not found", variantID))
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,210 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+)
+
+type Store struct {
+	// dependency injection, so this depends on *sql.DB
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateRefreshToken(token types.RefreshToken) error {
+	_, err := s.db.Exec("insert into refresh_tokens (userId, sessionId, tokenHash, expiresAt) values (?, ?, ?, ?)", token.UserID, token.SessionID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetRefreshTokenByHash(tokenHash string) (*types.RefreshToken, error) {
+	rows, err := s.db.Query("SELECT * FROM refresh_tokens WHERE tokenHash = ?", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	token := new(types.RefreshToken)
+	for rows.Next() {
+		token, err = scanRowIntoRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token.ID == 0 {
+		return nil, fmt.Errorf("refresh token not found")
+	}
+
+	return token, nil
+}
+
+/* Revoke the old refresh token and store the next one of the same session.
+*	both happen in one transaction, so two requests racing with the same token
+*	can't both get a new one. the loser gets types.ErrRefreshTokenReused
+ */
+func (s *Store) RotateRefreshToken(oldID int, next types.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("update refresh_tokens set revokedAt = now() where id = ? and revokedAt is null", oldID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return types.ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec("insert into refresh_tokens (userId, sessionId, tokenHash, expiresAt) values (?, ?, ?, ?)", next.UserID, next.SessionID, next.TokenHash, next.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revoke the session and every refresh token of it (token family)
+func (s *Store) RevokeSession(sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("update sessions set revokedAt = now() where id = ? and revokedAt is null", sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("update refresh_tokens set revokedAt = now() where sessionId = ? and revokedAt is null", sessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// log out everywhere
+func (s *Store) RevokeUserSessions(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("update sessions set revokedAt = now() where userId = ? and revokedAt is null", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("update refresh_tokens set revokedAt = now() where userId = ? and revokedAt is null", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* A session is active as long as it still has an unrevoked, unexpired refresh token.
+*	rotation always leaves the newest token unrevoked, logout and reuse detection revoke all of them
+ */
+func (s *Store) IsSessionActive(sessionID string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("select count(*) from refresh_tokens where sessionId = ? and revokedAt is null and expiresAt > ?", sessionID, time.Now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *Store) CreateSession(session types.Session) error {
+	_, err := s.db.Exec("insert into sessions (id, userId, userAgent, ip) values (?, ?, ?, ?)", session.ID, session.UserID, session.UserAgent, session.IP)
+	return err
+}
+
+func (s *Store) GetSessionByID(sessionID string) (*types.Session, error) {
+	rows, err := s.db.Query("SELECT * FROM sessions WHERE id = ?", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session := new(types.Session)
+	for rows.Next() {
+		session, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.ID == "" {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	return session, nil
+}
+
+func (s *Store) GetActiveSessionsByUserID(userID int) ([]types.Session, error) {
+	rows, err := s.db.Query(`SELECT * FROM sessions WHERE userId = ? AND revokedAt IS NULL
+		AND EXISTS (SELECT 1 FROM refresh_tokens WHERE sessionId = sessions.id AND revokedAt IS NULL AND expiresAt > ?)
+		ORDER BY lastSeenAt DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]types.Session, 0)
+	for rows.Next() {
+		session, err := scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (s *Store) TouchSession(sessionID string, lastSeenAt time.Time) error {
+	_, err := s.db.Exec("update sessions set lastSeenAt = ? where id = ?", lastSeenAt, sessionID)
+	return err
+}
+
+func scanRowIntoSession(rows *sql.Rows) (*types.Session, error) {
+	session := new(types.Session)
+	err := rows.Scan(&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func scanRowIntoRefreshToken(rows *sql.Rows) (*types.RefreshToken, error) {
+	token := new(types.RefreshToken)
+	err := rows.Scan(&token.ID,
+		&token.UserID,
+		&token.SessionID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,311 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultUsersLimit = 20
+	maxUsersLimit     = 100
+)
+
+// GET /admin/users?q=&role=&suspended=&page=&limit=
+func (h *Handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := types.UserFilter{
+		Query: query.Get("q"),
+		Role: query.Get("role"),
+		Limit: defaultUsersLimit,
+	}
+
+	if v := query.Get("suspended"); v != "" {
+		suspended, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("suspended must be true or false"))
+			return
+		}
+		filter.Suspended = &suspended
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxUsersLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxUsersLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	page := 1
+	if v := query.Get("page"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 1 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("page must be a positive number"))
+			return
+		}
+		page = p
+	}
+	filter.Offset = (page - 1) * filter.Limit
+
+	users, total, err := h.store.GetUsers(filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"users": users,
+		"total": total,
+		"page": page,
+		"limit": filter.Limit,
+	})
+}
+
+// the user with their order count and lifetime spend
+func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.store.GetUserStats(u.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"user": u,
+		"orderCount": stats.OrderCount,
+		"lifetimeSpend": stats.LifetimeSpend,
+	})
+}
+
+/* Suspend the account, logging the user out everywhere.
+*	WithJWTAuth refuses the access tokens still out there, login and refresh are refused too
+ */
+func (h *Handler) handleSuspendUser(w http.ResponseWriter, r *http.Request) {
+	var payload types.SuspendUserPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, ok := h.managedUser(w, r)
+	if !ok {
+		return
+	}
+	if u.SuspendedAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("user is already suspended"))
+		return
+	}
+
+	now := time.Now()
+	if err := h.store.SetUserSuspended(u.ID, &now); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.sessionStore.RevokeUserSessions(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit(r, types.AuditActionUserSuspended, u.ID, payload.Reason)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "user suspended"})
+}
+
+func (h *Handler) handleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.managedUser(w, r)
+	if !ok {
+		return
+	}
+	if u.SuspendedAt == nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("user is not suspended"))
+		return
+	}
+
+	if err := h.store.SetUserSuspended(u.ID, nil); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit(r, types.AuditActionUserReactivated, u.ID, "")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "user reactivated"})
+}
+
+/* Make the user choose a new password, e.g. after their account was taken over.
+*	the current password stops working and every session ends, the user gets a reset link
+ */
+func (h *Handler) handleForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.managedUser(w, r)
+	if !ok {
+		return
+	}
+
+	// an empty hash never matches
+	if err := h.store.UpdatePassword(u.ID, ""); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.sessionStore.RevokeUserSessions(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.sendPasswordResetLink(u); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit(r, types.AuditActionPasswordResetForced, u.ID, "")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "password reset sent"})
+}
+
+/* Let an admin see the store as the user does, e.g. to debug a checkout problem.
+*	the token carries the admin as actor, so every request made with it is audited and the routes
+*	only the user may use (password, payment, 2FA, ...) refuse it. it runs in its own session,
+*	which shows up in the user's session list and ends after IMPERSONATION_EXP
+ */
+func (h *Handler) handleImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	var payload types.ImpersonateUserPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, ok := h.managedUser(w, r)
+	if !ok {
+		return
+	}
+	// acting as another staff member or admin would only hide who did what
+	if u.Role != types.RoleCustomer {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only customers can be impersonated"))
+		return
+	}
+	if u.SuspendedAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("user is suspended"))
+		return
+	}
+
+	actorID := auth.GetUserIDFromContext(r.Context())
+	expiresAt := time.Now().Add(time.Duration(config.Envs.ImpersonationExpirationInSeconds)*time.Second)
+
+	sessionID, err := auth.GenerateRandomID(16)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.sessionStore.CreateSession(types.Session{
+		ID: sessionID,
+		UserID: u.ID,
+		UserAgent: fmt.Sprintf("impersonated by admin %d", actorID),
+		IP: utils.ClientIP(r),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// keeps the session active until the impersonation ends, it's never handed out so it can't be refreshed
+	refreshToken, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.sessionStore.CreateRefreshToken(types.RefreshToken{
+		UserID: u.ID,
+		SessionID: sessionID,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := auth.CreateImpersonationJWT(u, sessionID, actorID, expiresAt)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit(r, types.AuditActionImpersonationStarted, u.ID, payload.Reason)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"token": token,
+		"sessionID": sessionID,
+		"expiresAt": expiresAt,
+	})
+}
+
+func (h *Handler) targetUser(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return nil, false
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil || u.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user with id %d not found", userID))
+		return nil, false
+	}
+	return u, true
+}
+
+// staff can only act on customers, admins on anyone but themselves
+func (h *Handler) managedUser(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	u, ok := h.targetUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if u.ID == auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("you can't do this to your own account"))
+		return nil, false
+	}
+	if auth.GetRoleFromContext(r.Context()) != types.RoleAdmin && u.Role != types.RoleCustomer {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only admins can manage %s accounts", u.Role))
+		return nil, false
+	}
+	return u, true
+}
+
+// a lost audit entry doesn't undo the action
+func (h *Handler) audit(r *http.Request, action string, userID int, details string) {
+	err := h.auditStore.CreateAuditEntry(types.AuditEntry{
+		ActorID: auth.GetUserIDFromContext(r.Context()),
+		Action: action,
+		TargetType: "user",
+		TargetID: strconv.Itoa(userID),
+		Details: details,
+		IP: utils.ClientIP(r),
+	})
+	if err != nil {
+		log.Printf("failed to write audit entry %s for user %d: %v", action, userID, err)
+	}
+}
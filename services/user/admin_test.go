@@ -0,0 +1,203 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/mailer"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/gorilla/mux"
+)
+
+func TestAdminUserHandler(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, FirstName: "user", Email: "user@example.com", Password: hashed, Role: types.RoleCustomer},
+		{ID: 2, FirstName: "other", Email: "other@example.com", Password: hashed, Role: types.RoleCustomer},
+		{ID: 3, Email: "staff@example.com", Role: types.RoleStaff},
+		{ID: 4, Email: "admin@example.com", Role: types.RoleAdmin},
+	}}
+	sessionStore := newMockSessionStore()
+	sessionStore.add("user-token", "user-session", time.Now().Add(time.Hour))
+	auditStore := &mockAuditStore{}
+	outbox := mailer.NewOutboxMailer(t.TempDir(), "shop@example.com")
+	handler := NewHandler(userStore, sessionStore, outbox, newTestLimiter(), newTestLimiter(), auditStore, &mockExportStore{})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/users", handler.handleGetUsers).Methods(http.MethodGet)
+	router.HandleFunc("/admin/users/{userID}", handler.handleGetUser).Methods(http.MethodGet)
+	router.HandleFunc("/admin/users/{userID}/suspend", handler.handleSuspendUser).Methods(http.MethodPost)
+	router.HandleFunc("/admin/users/{userID}/reactivate", handler.handleReactivateUser).Methods(http.MethodPost)
+	router.HandleFunc("/admin/users/{userID}/password-reset", handler.handleForcePasswordReset).Methods(http.MethodPost)
+	router.HandleFunc("/admin/users/{userID}/impersonate", handler.handleImpersonateUser).Methods(http.MethodPost)
+
+	// staff is user 3, admin is user 4
+	serve := func(method, path string, actorID int, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.WithValue(req.Context(), auth.UserKey, actorID)
+		ctx = context.WithValue(ctx, auth.RoleKey, userStore.users[actorID-1].Role)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	t.Run("should list and search users with pagination", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/admin/users?q=example.com&limit=3&page=2", 3, nil)
+		var res struct {
+			Users []types.User `json:"users"`
+			Total int          `json:"total"`
+			Page  int          `json:"page"`
+		}
+		json.NewDecoder(rr.Body).Decode(&res)
+		if rr.Code != http.StatusOK || res.Total != 4 || res.Page != 2 || len(res.Users) != 1 {
+			t.Errorf("expected the second page of 4 users, got %d %+v", rr.Code, res)
+		}
+
+		if rr := serve(http.MethodGet, "/admin/users?limit=1000", 3, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should show a user with their order stats", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/admin/users/1", 3, nil)
+		var res struct {
+			User          types.User `json:"user"`
+			OrderCount    int        `json:"orderCount"`
+			LifetimeSpend float64    `json:"lifetimeSpend"`
+		}
+		json.NewDecoder(rr.Body).Decode(&res)
+		if rr.Code != http.StatusOK || res.User.ID != 1 || res.OrderCount != 2 || res.LifetimeSpend != 30 {
+			t.Errorf("unexpected response %d %+v", rr.Code, res)
+		}
+	})
+
+	t.Run("should not let staff manage other staff or admins", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/admin/users/4/suspend", 3, types.SuspendUserPayload{Reason: "test"}); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if rr := serve(http.MethodPost, "/admin/users/4/suspend", 4, types.SuspendUserPayload{Reason: "test"}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected admins to be unable to suspend themselves, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should suspend a user and end their sessions", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/admin/users/1/suspend", 3, types.SuspendUserPayload{Reason: "chargeback fraud"}); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[0].SuspendedAt == nil {
+			t.Errorf("expected the user to be suspended")
+		}
+		if active, _ := sessionStore.IsSessionActive("user-session"); active {
+			t.Errorf("expected the session to be revoked")
+		}
+		last := auditStore.entries[len(auditStore.entries)-1]
+		if last.Action != types.AuditActionUserSuspended || last.ActorID != 3 || last.TargetID != "1" || last.Details != "chargeback fraud" {
+			t.Errorf("unexpected audit entry %+v", last)
+		}
+
+		suspended := serve(http.MethodGet, "/admin/users?suspended=true", 3, nil)
+		var res struct {
+			Total int `json:"total"`
+		}
+		json.NewDecoder(suspended.Body).Decode(&res)
+		if res.Total != 1 {
+			t.Errorf("expected 1 suspended user, got %d", res.Total)
+		}
+	})
+
+	t.Run("should refuse the login of a suspended user", func(t *testing.T) {
+		marshalled, _ := json.Marshal(types.LoginUserPayload{Email: "user@example.com", Password: "asdfgasdfasdf"})
+		req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		rr := httptest.NewRecorder()
+		handler.handleLogin(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reactivate the user", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/admin/users/1/reactivate", 3, nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[0].SuspendedAt != nil {
+			t.Errorf("expected the user to be reactivated")
+		}
+		if rr := serve(http.MethodPost, "/admin/users/1/reactivate", 3, nil); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should force a password reset", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/admin/users/2/password-reset", 4, nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if auth.ComparePasswords(userStore.users[1].Password, []byte("asdfgasdfasdf")) {
+			t.Errorf("expected the old password to stop working")
+		}
+		emails, _ := outbox.Messages()
+		if len(emails) != 1 || emails[0].To != "other@example.com" {
+			t.Errorf("expected a reset link to the user, got %+v", emails)
+		}
+	})
+
+	t.Run("should only impersonate customers", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/admin/users/3/impersonate", 4, types.ImpersonateUserPayload{Reason: "test"}); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if rr := serve(http.MethodPost, "/admin/users/2/impersonate", 4, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a reason to be required, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should impersonate a customer with an audited token", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/admin/users/2/impersonate", 4, types.ImpersonateUserPayload{Reason: "ticket 1234"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var res struct {
+			Token     string `json:"token"`
+			SessionID string `json:"sessionID"`
+		}
+		json.NewDecoder(rr.Body).Decode(&res)
+		last := auditStore.entries[len(auditStore.entries)-1]
+		if last.Action != types.AuditActionImpersonationStarted || last.ActorID != 4 || last.TargetID != "2" || last.Details != "ticket 1234" {
+			t.Errorf("unexpected audit entry %+v", last)
+		}
+
+		auth.EnableImpersonation(auditStore)
+		defer auth.EnableImpersonation(nil)
+		var userID, actorID int
+		me := auth.WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+			userID = auth.GetUserIDFromContext(r.Context())
+			actorID = auth.GetActorIDFromContext(r.Context())
+		}, userStore, sessionStore)
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+res.Token)
+		me(httptest.NewRecorder(), req)
+		if userID != 2 || actorID != 4 {
+			t.Errorf("expected user 2 impersonated by 4, got %d by %d", userID, actorID)
+		}
+		last = auditStore.entries[len(auditStore.entries)-1]
+		if last.Action != types.AuditActionImpersonatedRequest || last.Details != "GET /me" {
+			t.Errorf("expected the request to be audited, got %+v", last)
+		}
+
+		// logging out ends the impersonation
+		sessionStore.RevokeSession(res.SessionID)
+		rr = httptest.NewRecorder()
+		me(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultLoginAttemptsLimit = 50
+	maxLoginAttemptsLimit     = 500
+)
+
+/* Refuse the attempt with 429 while the account or the client IP has to wait.
+*	the account is keyed by email so unknown emails are throttled the same as registered ones
+ */
+func (h *Handler) loginThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	wait := h.accountLimiter.Check(accountKey(email))
+	if ipWait := h.ipLimiter.Check(utils.ClientIP(r)); ipWait > wait {
+		wait = ipWait
+	}
+	if wait == 0 {
+		return false
+	}
+
+	h.recordLoginAttempt(r, 0, email, false, types.LoginReasonThrottled)
+	writeTooManyAttempts(w, wait)
+	return true
+}
+
+// count the failure against the account and the client IP
+func (h *Handler) loginFailed(r *http.Request, userID int, email, reason string) {
+	h.accountLimiter.Fail(accountKey(email))
+	h.ipLimiter.Fail(utils.ClientIP(r))
+	h.recordLoginAttempt(r, userID, email, false, reason)
+}
+
+// the IP is not reset, a single client logging into many accounts is suspicious on its own
+func (h *Handler) loginSucceeded(r *http.Request, u *types.User) {
+	h.accountLimiter.Reset(accountKey(u.Email))
+	h.recordLoginAttempt(r, u.ID, u.Email, true, types.LoginReasonSuccess)
+}
+
+func (h *Handler) recordLoginAttempt(r *http.Request, userID int, email string, success bool, reason string) {
+	err := h.store.RecordLoginAttempt(types.LoginAttempt{
+		UserID: userID,
+		Email: email,
+		IP: utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success: success,
+		Reason: reason,
+	})
+	if err != nil {
+		log.Printf("failed to record login attempt: %v", err)
+	}
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.WriteError(w, http.StatusTooManyRequests, fmt.Errorf("too many failed login attempts, try again in %d seconds", seconds))
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lift the lockout of an account before it runs out, e.g. after support confirmed the owner
+func (h *Handler) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user with id %d not found", userID))
+		return
+	}
+
+	h.accountLimiter.Reset(accountKey(u.Email))
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "account unlocked"})
+}
+
+// GET /admin/login-attempts?userID=&email=&ip=&limit=, newest first
+func (h *Handler) handleGetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := types.LoginAttemptFilter{
+		Email: query.Get("email"),
+		IP: query.Get("ip"),
+		Limit: defaultLoginAttemptsLimit,
+	}
+
+	if v := query.Get("userID"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+			return
+		}
+		filter.UserID = userID
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLoginAttemptsLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxLoginAttemptsLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	attempts, err := h.store.GetLoginAttempts(filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, attempts)
+}
@@ -0,0 +1,138 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+)
+
+const oidcStateCookie = "oidc_state"
+
+var errUnverifiedIdentity = errors.New("the identity provider didn't verify the email")
+
+// turn on social login, call it before RegisterRoutes
+func (h *Handler) EnableOIDC(provider *auth.OIDCProvider) {
+	h.oidcProvider = provider
+}
+
+// redirect to the provider, the state travels along in a short lived cookie
+func (h *Handler) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	url, state, err := h.oidcProvider.AuthCodeURL()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.SetCookie(w, oidcCookie(state, 600))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+/* The provider sends the user back here with the code.
+*	the user is found by the linked identity, then by verified email, and created otherwise.
+*	answers like handleLogin, with tokens or a 2FA challenge
+ */
+func (h *Handler) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// the state is single use
+	http.SetCookie(w, oidcCookie("", -1))
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("login at the identity provider failed: %s", e))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("login expired, try again"))
+		return
+	}
+	state, err := auth.ValidateOIDCState(cookie.Value)
+	if err != nil || query.Get("state") == "" || state.State != query.Get("state") {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("login expired, try again"))
+		return
+	}
+
+	identity, err := h.oidcProvider.Exchange(r.Context(), query.Get("code"), state)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("login at the identity provider failed"))
+		return
+	}
+
+	u, err := h.userForIdentity(identity)
+	if err == errUnverifiedIdentity {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.finishLogin(w, r, u)
+}
+
+func (h *Handler) userForIdentity(identity *auth.OIDCIdentity) (*types.User, error) {
+	provider := h.oidcProvider.Name()
+	if u, err := h.store.GetUserByIdentity(provider, identity.Subject); err == nil {
+		return u, nil
+	}
+
+	// only an email the provider vouches for can be linked to an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errUnverifiedIdentity
+	}
+
+	u, err := h.store.GetUserByEmail(identity.Email)
+	if err != nil {
+		// no password, one can be set with the forgot password flow
+		err = h.store.CreateUser(types.User{
+			FirstName: identity.GivenName,
+			LastName: identity.FamilyName,
+			Email: identity.Email,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if u, err = h.store.GetUserByEmail(identity.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.VerifiedAt == nil {
+		if err := h.markEmailVerified(u); err != nil {
+			return nil, err
+		}
+	}
+
+	err = h.store.CreateUserIdentity(types.UserIdentity{
+		UserID: u.ID,
+		Provider: provider,
+		Subject: identity.Subject,
+		Email: identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.store.GetUserByID(u.ID)
+}
+
+func oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name: oidcStateCookie,
+		Value: value,
+		Path: "/api/v1/auth/oidc",
+		MaxAge: maxAge,
+		HttpOnly: true,
+		Secure: strings.HasPrefix(config.Envs.AppURL, "https://"),
+		// sent along on the top level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,227 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/mailer"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{{ID: 1, Email: "existing@example.com", Password: hashed}}}
+	handler := NewHandler(userStore, newMockSessionStore(), mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	cfg := config.Envs
+	cfg.OIDCIssuerURL = provider.server.URL
+	cfg.OIDCClientID = "go-ecom"
+	cfg.OIDCClientSecret = "secret"
+	cfg.OIDCRedirectURL = "http://localhost/api/v1/auth/oidc/callback"
+	oidcProvider, err := auth.NewOIDCProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.EnableOIDC(oidcProvider)
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router.PathPrefix("/api/v1").Subrouter())
+
+	// the whole round trip: our redirect, the login at the provider, the callback
+	login := func(claims map[string]any) (*httptest.ResponseRecorder, map[string]any) {
+		provider.next = claims
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("expected status code %d, got %d", http.StatusFound, rr.Code)
+		}
+		cookies := rr.Result().Cookies()
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		res, err := client.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		req := httptest.NewRequest(http.MethodGet, res.Header.Get("Location"), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var body map[string]any
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr, body
+	}
+
+	t.Run("should create a verified user on the first login", func(t *testing.T) {
+		rr, body := login(map[string]any{"sub": "new-sub", "email": "new@example.com", "email_verified": true, "given_name": "new", "family_name": "user"})
+		if rr.Code != http.StatusOK || body["token"] == nil {
+			t.Fatalf("expected tokens, got %d %v", rr.Code, body)
+		}
+		u, err := userStore.GetUserByEmail("new@example.com")
+		if err != nil || u.VerifiedAt == nil || u.FirstName != "new" {
+			t.Errorf("unexpected user %+v", u)
+		}
+	})
+
+	t.Run("should find the user by the linked identity", func(t *testing.T) {
+		// the email at the provider changed, the subject didn't
+		rr, body := login(map[string]any{"sub": "new-sub", "email": "renamed@example.com", "email_verified": true})
+		if rr.Code != http.StatusOK || body["token"] == nil {
+			t.Fatalf("expected tokens, got %d %v", rr.Code, body)
+		}
+		if len(userStore.users) != 2 {
+			t.Errorf("expected no new user, got %d users", len(userStore.users))
+		}
+	})
+
+	t.Run("should link an existing user by verified email", func(t *testing.T) {
+		rr, _ := login(map[string]any{"sub": "existing-sub", "email": "existing@example.com", "email_verified": true})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if u, err := userStore.GetUserByIdentity(cfg.OIDCProviderName, "existing-sub"); err != nil || u.ID != 1 {
+			t.Errorf("expected the identity to be linked to user 1, got %+v", u)
+		}
+	})
+
+	t.Run("should not link an unverified email", func(t *testing.T) {
+		rr, _ := login(map[string]any{"sub": "attacker-sub", "email": "existing@example.com", "email_verified": false})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject a callback without the state cookie", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=x&state=y", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject an ID token with another nonce", func(t *testing.T) {
+		provider.nonce = "replayed"
+		defer func() { provider.nonce = "" }()
+		rr, _ := login(map[string]any{"sub": "new-sub", "email": "new@example.com", "email_verified": true})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+// OpenID provider on a local server: discovery, JWKS, authorize (logs the user in right away) and token
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// claims of the user logging in next
+	next map[string]any
+	// overrides the nonce in the ID token
+	nonce string
+	codes map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+	claims    map[string]any
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDCProvider{key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer": m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint": m.server.URL + "/token",
+			"jwks_uri": m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "PKCE required", http.StatusBadRequest)
+			return
+		}
+		code, _ := auth.GenerateRandomToken(16)
+		m.codes[code] = mockAuthorization{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), claims: m.next}
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		authorization, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		nonce := authorization.nonce
+		if m.nonce != "" {
+			nonce = m.nonce
+		}
+		claims := jwt.MapClaims{
+			"iss": m.server.URL,
+			"aud": "go-ecom",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+			"nonce": nonce,
+		}
+		for k, v := range authorization.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
@@ -0,0 +1,204 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, u)
+}
+
+/* Update the name and/or email of the logged in user.
+*	a new email is not verified anymore, a verification link goes to the new address
+*	and a notice to the old one
+ */
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	var payload types.UpdateProfilePayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// every check comes before the write, a refused email change doesn't change the name either
+	oldEmail := u.Email
+	emailChanged := payload.Email != nil && !strings.EqualFold(*payload.Email, u.Email)
+	if emailChanged {
+		// with a stolen access token the email and then the password could be taken over
+		if !h.checkCurrentPassword(w, r, u, payload.CurrentPassword) {
+			return
+		}
+		if _, err := h.store.GetUserByEmail(*payload.Email); err == nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", *payload.Email))
+			return
+		}
+		u.Email = *payload.Email
+		u.VerifiedAt = nil
+	}
+	if payload.FirstName != nil {
+		u.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		u.LastName = *payload.LastName
+	}
+
+	if err := h.store.UpdateUserProfile(u.ID, u.FirstName, u.LastName, u.Email); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if emailChanged {
+		if err := h.sendVerificationEmail(u); err != nil {
+			log.Printf("failed to send verification email: %v", err)
+		}
+		if err := h.sendEmailChangedNotice(u, oldEmail); err != nil {
+			log.Printf("failed to send email change notice: %v", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, u)
+}
+
+/* Change the password of the logged in user.
+*	every session is revoked and a new one is started for the caller
+ */
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ChangePasswordPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, u, payload.CurrentPassword) {
+		return
+	}
+	if !checkPasswordPolicy(w, "newPassword", payload.NewPassword, u.Email, u.FirstName, u.LastName) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		writeHashError(w, err)
+		return
+	}
+	if err := h.store.UpdatePassword(u.ID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// whoever knew the old password gets logged out
+	if err := h.sessionStore.RevokeUserSessions(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.issueTokens(w, r, u)
+}
+
+/* Delete the account of the logged in user.
+*	the orders are kept for accounting, without the personal data
+ */
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	var payload types.DeleteAccountPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, u, payload.CurrentPassword) {
+		return
+	}
+
+	if err := h.deleteUser(r, u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "account deleted"})
+}
+
+// guessing the current password goes through the same throttling as the login
+func (h *Handler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, u *types.User, password string) bool {
+	// accounts created by an OIDC login have nothing to compare to, that isn't a failed login
+	if u.Password == "" {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("this account has no password yet, set one with /password/forgot first"))
+		return false
+	}
+	if h.loginThrottled(w, r, u.Email) {
+		return false
+	}
+	if !auth.ComparePasswords(u.Password, []byte(password)) {
+		h.loginFailed(r, u.ID, u.Email, types.LoginReasonInvalidCredentials)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("current password is incorrect"))
+		return false
+	}
+	return true
+}
+
+// let the owner of the old address know, in case it wasn't them
+func (h *Handler) sendEmailChangedNotice(u *types.User, oldEmail string) error {
+	return h.mailer.Send(types.Email{
+		To: oldEmail,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe email address of your account was changed to %s.\n\nIf you didn't do this, please contact us right away.",
+			u.FirstName, u.Email),
+	})
+}
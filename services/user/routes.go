@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/faldeus0092/go-ecom/config"
 	"github.com/faldeus0092/go-ecom/services/auth"
@@ -15,16 +17,56 @@ import (
 
 type Handler struct {
 	store types.UserStore //we need userstore to interact with db
+	sessionStore types.SessionStore // refresh tokens
+	mailer types.Mailer
+	accountLimiter types.LoginLimiter // failed logins per email
+	ipLimiter types.LoginLimiter // failed logins per client IP
+	auditStore types.AuditStore
+	exportStore types.DataExportStore // exports go with the account
+	oidcProvider *auth.OIDCProvider // nil when social login is off
 }
 
 // make it same with Handler struct
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.UserStore, sessionStore types.SessionStore, mailer types.Mailer, accountLimiter types.LoginLimiter, ipLimiter types.LoginLimiter, auditStore types.AuditStore, exportStore types.DataExportStore) *Handler {
+	return &Handler{store: store, sessionStore: sessionStore, mailer: mailer, accountLimiter: accountLimiter, ipLimiter: ipLimiter, auditStore: auditStore, exportStore: exportStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods("POST")
 	router.HandleFunc("/register", h.handleRegister).Methods("POST")
+	router.HandleFunc("/token/refresh", h.handleRefresh).Methods("POST")
+	router.HandleFunc("/logout", auth.WithJWTAuth(h.handleLogout, h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/password/forgot", h.handleForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", h.handleResetPassword).Methods("POST")
+	router.HandleFunc("/verify-email", h.handleVerifyEmail).Methods("GET")
+	router.HandleFunc("/verify-email/resend", h.handleResendVerification).Methods("POST")
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleGetMe, h.store, h.sessionStore)).Methods("GET")
+	router.HandleFunc("/me", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleUpdateMe), h.store, h.sessionStore)).Methods("PATCH")
+	router.HandleFunc("/me", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleDeleteMe), h.store, h.sessionStore)).Methods("DELETE")
+	router.HandleFunc("/me/sessions", auth.WithJWTAuth(h.handleGetSessions, h.store, h.sessionStore)).Methods("GET")
+	router.HandleFunc("/me/sessions", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleRevokeAllSessions), h.store, h.sessionStore)).Methods("DELETE")
+	router.HandleFunc("/me/sessions/{sessionID}", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleRevokeSession), h.store, h.sessionStore)).Methods("DELETE")
+	router.HandleFunc("/me/password", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleChangePassword), h.store, h.sessionStore)).Methods("POST")
+	if h.oidcProvider != nil {
+		router.HandleFunc("/auth/oidc/login", h.handleOIDCLogin).Methods("GET")
+		router.HandleFunc("/auth/oidc/callback", h.handleOIDCCallback).Methods("GET")
+	}
+	router.HandleFunc("/login/2fa", h.handleTwoFactorLogin).Methods("POST")
+	router.HandleFunc("/2fa/enroll", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleTwoFactorEnroll), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/2fa/confirm", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleTwoFactorConfirm), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/2fa/disable", auth.WithJWTAuth(auth.WithoutImpersonation(h.handleTwoFactorDisable), h.store, h.sessionStore)).Methods("POST")
+
+	// user management
+	router.HandleFunc("/admin/users", auth.WithJWTAuth(auth.WithRole(h.handleGetUsers, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("GET")
+	router.HandleFunc("/admin/users/{userID}", auth.WithJWTAuth(auth.WithRole(h.handleGetUser, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("GET")
+	router.HandleFunc("/admin/users/{userID}/suspend", auth.WithJWTAuth(auth.WithRole(h.handleSuspendUser, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/admin/users/{userID}/reactivate", auth.WithJWTAuth(auth.WithRole(h.handleReactivateUser, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/admin/users/{userID}/password-reset", auth.WithJWTAuth(auth.WithRole(h.handleForcePasswordReset, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/admin/users/{userID}/impersonate", auth.WithJWTAuth(auth.WithoutImpersonation(auth.WithRole(h.handleImpersonateUser, types.RoleAdmin)), h.store, h.sessionStore)).Methods("POST")
+	router.HandleFunc("/admin/users/{userID}/role", auth.WithJWTAuth(auth.WithRole(h.handleUpdateUserRole, types.RoleAdmin), h.store, h.sessionStore)).Methods("PUT")
+	router.HandleFunc("/admin/users/{userID}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteUser, types.RoleAdmin), h.store, h.sessionStore)).Methods("DELETE")
+	router.HandleFunc("/admin/users/{userID}/lockout", auth.WithJWTAuth(auth.WithRole(h.handleUnlockUser, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("DELETE")
+	router.HandleFunc("/admin/login-attempts", auth.WithJWTAuth(auth.WithRole(h.handleGetLoginAttempts, types.RoleStaff, types.RoleAdmin), h.store, h.sessionStore)).Methods("GET")
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request){
@@ -44,25 +86,511 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
+	if h.loginThrottled(w, r, payload.Email) {
+		return
+	}
+
 	// check if user exists
 	u, err := h.store.GetUserByEmail(payload.Email)
 	if err != nil {
+		h.loginFailed(r, 0, payload.Email, types.LoginReasonInvalidCredentials)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user not found, invalid email or password"))
 		return
 	}
 	
 	if !auth.ComparePasswords(u.Password, []byte(payload.Password)){
+		h.loginFailed(r, u.ID, payload.Email, types.LoginReasonInvalidCredentials)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user not found, invalid email or password"))
 		return
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, u.ID)
+	// the plain password is only around now, move old hashes to the configured hasher
+	if auth.PasswordNeedsRehash(u.Password) {
+		h.rehashPassword(u, payload.Password)
+	}
+
+	if config.Envs.RequireVerifiedEmailForLogin && u.VerifiedAt == nil {
+		h.recordLoginAttempt(r, u.ID, u.Email, false, types.LoginReasonUnverified)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("email not verified"))
+		return
+	}
+
+	h.finishLogin(w, r, u)
+}
+
+// the first factor is done, ask for the second one or start the session
+func (h *Handler) finishLogin(w http.ResponseWriter, r *http.Request, u *types.User) {
+	if u.SuspendedAt != nil {
+		h.recordLoginAttempt(r, u.ID, u.Email, false, types.LoginReasonSuspended)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("account suspended"))
+		return
+	}
+
+	// second step needed, the tokens are only issued by handleTwoFactorLogin.
+	// the failures are not reset yet, the password alone shouldn't buy more guesses at the code
+	if u.TOTPEnabledAt != nil {
+		h.recordLoginAttempt(r, u.ID, u.Email, false, types.LoginReasonTwoFactorRequired)
+		challenge, err := auth.CreateTwoFactorChallenge(u)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]any{"twoFactorRequired": true, "challengeToken": challenge})
+		return
+	}
+
+	h.loginSucceeded(r, u)
+	h.issueTokens(w, r, u)
+}
+
+// start a new session for the user and write the access and refresh tokens
+func (h *Handler) issueTokens(w http.ResponseWriter, r *http.Request, u *types.User) {
+	// every login starts a new session (refresh token family)
+	sessionID, err := auth.GenerateRandomID(16)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.sessionStore.CreateSession(types.Session{
+		ID: sessionID,
+		UserID: u.ID,
+		UserAgent: truncate(r.UserAgent(), 255),
+		IP: utils.ClientIP(r),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	refreshToken, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.sessionStore.CreateRefreshToken(types.RefreshToken{
+		UserID: u.ID,
+		SessionID: sessionID,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: refreshTokenExpiry(),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := auth.CreateJWT(u, sessionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token, "refreshToken": refreshToken})
+}
+
+/* Exchange a refresh token for a new access token and a new refresh token.
+*	the presented refresh token can only be used once. presenting it again means
+*	it was stolen (or the client is broken), so the whole session gets revoked
+ */
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	current, err := h.sessionStore.GetRefreshTokenByHash(auth.HashToken(payload.RefreshToken))
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+
+	// reuse detection
+	if current.RevokedAt != nil {
+		h.revokeReusedSession(current)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("refresh token expired"))
+		return
+	}
+
+	// reload the user so the new access token carries the current role
+	u, err := h.store.GetUserByID(current.UserID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+	if u.SuspendedAt != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("account suspended"))
+		return
+	}
+
+	refreshToken, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.sessionStore.RotateRefreshToken(current.ID, types.RefreshToken{
+		UserID: current.UserID,
+		SessionID: current.SessionID,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: refreshTokenExpiry(),
+	})
+	if err == types.ErrRefreshTokenReused {
+		// another request rotated this token first
+		h.revokeReusedSession(current)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := auth.CreateJWT(u, current.SessionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token, "refreshToken": refreshToken})
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	sessionID := auth.GetSessionIDFromContext(r.Context())
+	if err := h.sessionStore.RevokeSession(sessionID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.ValidateEmailVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired verification link"))
+		return
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired verification link"))
+		return
+	}
+	u, err := h.store.GetUserByID(userID)
+	// the email changed since the link was sent
+	if err != nil || u.Email != claims.Email {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired verification link"))
+		return
+	}
+
+	if u.VerifiedAt == nil {
+		if err := h.markEmailVerified(u); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+// the email is proven to be the user's now, so the guest orders made with it become theirs
+func (h *Handler) markEmailVerified(u *types.User) error {
+	if err := h.store.MarkEmailVerified(u.ID); err != nil {
+		return err
+	}
+	claimed, err := h.store.ClaimGuestOrders(u.ID, u.Email)
+	if err != nil {
+		// the guest orders stay reachable through their lookup links
+		log.Printf("failed to claim the guest orders of user %d: %v", u.ID, err)
+		return nil
+	}
+	if claimed > 0 {
+		log.Printf("%d guest order(s) claimed by user %d", claimed, u.ID)
+	}
+	return nil
+}
+
+/* Send the verification email again, at most once per EMAIL_VERIFICATION_RESEND_INTERVAL.
+*	like forgot password, always answers the same
+ */
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResendVerificationPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil && u.VerifiedAt == nil {
+		interval := time.Duration(config.Envs.EmailVerificationResendIntervalInSeconds) * time.Second
+		if u.VerificationSentAt == nil || time.Since(*u.VerificationSentAt) >= interval {
+			if err := h.sendVerificationEmail(u); err != nil {
+				log.Printf("failed to send verification email: %v", err)
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "if the email is registered and not verified yet, a verification link has been sent"})
+}
+
+func (h *Handler) sendVerificationEmail(u *types.User) error {
+	token, err := auth.CreateEmailVerificationToken(u)
+	if err != nil {
+		return err
+	}
+
+	err = h.mailer.Send(types.Email{
+		To: u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s/api/v1/verify-email?token=%s",
+			u.FirstName, config.Envs.EmailVerificationExpirationInSeconds/3600, config.Envs.AppURL, token),
+	})
+	if err != nil {
+		return err
+	}
+	return h.store.MarkVerificationSent(u.ID)
+}
+
+/* Email a single use reset link to the user.
+*	always answers the same so it can't be used to find out which emails are registered
+ */
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	if err := h.sendPasswordReset(payload.Email); err != nil {
+		log.Printf("failed to send password reset: %v", err)
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "if the email is registered, a reset link has been sent"})
+}
+
+func (h *Handler) sendPasswordReset(email string) error {
+	u, err := h.store.GetUserByEmail(email)
+	if err != nil {
+		// unknown email, nothing to send
+		return nil
+	}
+	return h.sendPasswordResetLink(u)
+}
+
+func (h *Handler) sendPasswordResetLink(u *types.User) error {
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	err = h.store.CreatePasswordReset(types.PasswordReset{
+		UserID: u.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(config.Envs.PasswordResetExpirationInSeconds) * time.Second),
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(types.Email{
+		To: u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s/reset-password?token=%s\n\nIf you didn't ask for this, you can ignore this email.",
+			u.FirstName, config.Envs.PasswordResetExpirationInSeconds/60, config.Envs.AppURL, token),
+	})
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	reset, err := h.store.GetPasswordResetByHash(auth.HashToken(payload.Token))
+	if err != nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired reset token"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(reset.UserID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired reset token"))
+		return
+	}
+	if !checkPasswordPolicy(w, "password", payload.Password, u.Email, u.FirstName, u.LastName) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		writeHashError(w, err)
+		return
+	}
+
+	err = h.store.ResetPassword(*reset, hashedPassword)
+	if err == types.ErrPasswordResetUsed {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired reset token"))
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+
+	// whoever knew the old password gets logged out
+	if err := h.sessionStore.RevokeUserSessions(reset.UserID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "password has been reset"})
+}
+
+func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return
+	}
+
+	var payload types.UserRolePayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	// an admin demoting themselves could leave the shop without any admin
+	if userID == auth.GetUserIDFromContext(r.Context()) && payload.Role != types.RoleAdmin {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("admins can't change their own role"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user with id %d not found", userID))
+		return
+	}
+
+	if err := h.store.UpdateUserRole(u.ID, payload.Role); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	u.Role = payload.Role
+
+	utils.WriteJSON(w, http.StatusOK, u)
+}
+
+// GDPR deletion on behalf of the user, e.g. when asked by email
+func (h *Handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		return
+	}
+
+	// same as demoting, the shop could be left without any admin
+	if userID == auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("admins can't delete themselves"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil || u.DeletedAt != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user with id %d not found", userID))
+		return
+	}
+
+	if err := h.deleteUser(r, u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "user deleted"})
+}
+
+/* Log the user out everywhere, anonymize them and write the audit entry.
+*	the sessions go first, if anonymizing fails the user can still log in and try again
+ */
+func (h *Handler) deleteUser(r *http.Request, userID int) error {
+	if err := h.sessionStore.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	// before the user data, failing here leaves the account as it was so it can be tried again
+	if err := h.exportStore.DeleteUserExports(userID); err != nil {
+		return err
+	}
+	if err := h.store.AnonymizeUser(userID); err != nil {
+		return err
+	}
+
+	err := h.auditStore.CreateAuditEntry(types.AuditEntry{
+		ActorID: auth.GetUserIDFromContext(r.Context()),
+		Action: types.AuditActionUserDeleted,
+		TargetType: "user",
+		TargetID: strconv.Itoa(userID),
+		IP: utils.ClientIP(r),
+	})
+	if err != nil {
+		// the user is gone either way, don't make them retry
+		log.Printf("failed to write audit entry for deleting user %d: %v", userID, err)
+	}
+	return nil
+}
+
+func (h *Handler) revokeReusedSession(token *types.RefreshToken) {
+	log.Printf("refresh token reuse detected for user %d, revoking session %s", token.UserID, token.SessionID)
+	if err := h.sessionStore.RevokeSession(token.SessionID); err != nil {
+		log.Printf("failed to revoke session %s: %v", token.SessionID, err)
+	}
+}
+
+func refreshTokenExpiry() time.Time {
+	return time.Now().Add(time.Duration(config.Envs.RefreshTokenExpirationInSeconds) * time.Second)
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request){
@@ -89,10 +617,14 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request){
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", payload.Email))
 		return
 	}
+
+	if !checkPasswordPolicy(w, "password", payload.Password, payload.Email, payload.FirstName, payload.LastName) {
+		return
+	}
 	
 	hashedPassword, err := auth.HashPassword(payload.Password)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		writeHashError(w, err)
 		return
 	}
 	
@@ -108,8 +640,47 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request){
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	// the account exists even if the email can't go out, the user can ask for a resend
+	if u, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		if err := h.sendVerificationEmail(u); err != nil {
+			log.Printf("failed to send verification email: %v", err)
+		}
+	}
 	
 	utils.WriteJSON(w, http.StatusCreated, nil)
 	log.Println(err)
 	//33:57
-}
\ No newline at end of file
+}
+
+// a failed upgrade doesn't fail the login, the old hash keeps working
+func (h *Handler) rehashPassword(u *types.User, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("failed to rehash the password of user %d: %v", u.ID, err)
+		return
+	}
+	if err := h.store.UpdatePassword(u.ID, hashedPassword); err != nil {
+		log.Printf("failed to rehash the password of user %d: %v", u.ID, err)
+		return
+	}
+	u.Password = hashedPassword
+}
+
+// writes the field errors if the new password breaks the policy
+func checkPasswordPolicy(w http.ResponseWriter, field, password string, personal ...string) bool {
+	if problems := auth.CheckPassword(password, personal...); len(problems) > 0 {
+		utils.WriteFieldErrors(w, map[string][]string{field: problems})
+		return false
+	}
+	return true
+}
+
+// a password the hasher can't take is the client's fault
+func writeHashError(w http.ResponseWriter, err error) {
+	if err == auth.ErrPasswordTooLong {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, err)
+}
@@ -2,20 +2,28 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/mailer"
+	"github.com/faldeus0092/go-ecom/services/auth"
 	"github.com/faldeus0092/go-ecom/types"
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserServiceHandler(t *testing.T) {
 	userStore := &mockUserStore{}
-	handler := NewHandler(userStore)
+	handler := NewHandler(userStore, newMockSessionStore(), mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
 
 	t.Run("should fail if the user payload is invalid", func(t *testing.T){
 		payload := types.RegisterUserPayload{
@@ -48,7 +56,7 @@ func TestUserServiceHandler(t *testing.T) {
 	t.Run("should correctly register the user", func(t *testing.T) {
 		payload := types.RegisterUserPayload{
 			FirstName: "user",
-			LastName: "asdf",
+			LastName: "doe",
 			Email: "asd@gmail.com",
 			Password: "asdfgasdfasdf",
 		}
@@ -72,19 +80,1143 @@ func TestUserServiceHandler(t *testing.T) {
 			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
 		}
 	})
+
+	t.Run("should refuse a password against the policy with field errors", func(t *testing.T) {
+		payload := types.RegisterUserPayload{
+			FirstName: "Jonathan",
+			LastName: "doe",
+			Email: "jon@gmail.com",
+			Password: "jonathan1",
+		}
+		marshalled, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.handleRegister(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		var res struct {
+			Fields map[string][]string `json:"fields"`
+		}
+		json.NewDecoder(rr.Body).Decode(&res)
+		if len(res.Fields["password"]) != 1 || res.Fields["password"][0] != "must not contain your email or name" {
+			t.Errorf("expected a password field error, got %v", res.Fields)
+		}
+	})
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	sessionStore := newMockSessionStore()
+	handler := NewHandler(&mockUserStore{}, sessionStore, mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.RefreshTokenPayload{RefreshToken: token})
+		req, err := http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/token/refresh", handler.handleRefresh)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		sessionStore.add("rotate-token", "rotate-session", time.Now().Add(time.Hour))
+
+		rr := refresh("rotate-token")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var res map[string]string
+		json.NewDecoder(rr.Body).Decode(&res)
+		if res["token"] == "" || res["refreshToken"] == "" {
+			t.Errorf("expected both tokens in response, got %v", res)
+		}
+		if res["refreshToken"] == "rotate-token" {
+			t.Errorf("expected a new refresh token")
+		}
+		if active, _ := sessionStore.IsSessionActive("rotate-session"); !active {
+			t.Errorf("expected session to stay active after rotation")
+		}
+	})
+
+	t.Run("should revoke the session when a refresh token is reused", func(t *testing.T) {
+		sessionStore.add("reuse-token", "reuse-session", time.Now().Add(time.Hour))
+
+		if rr := refresh("reuse-token"); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if rr := refresh("reuse-token"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+		if active, _ := sessionStore.IsSessionActive("reuse-session"); active {
+			t.Errorf("expected session to be revoked after reuse")
+		}
+	})
+
+	t.Run("should fail if the refresh token is expired", func(t *testing.T) {
+		sessionStore.add("expired-token", "expired-session", time.Now().Add(-time.Minute))
+
+		if rr := refresh("expired-token"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestPasswordResetHandler(t *testing.T) {
+	userStore := &mockUserStore{users: []types.User{{ID: 1, FirstName: "user", Email: "user@example.com", Password: "old-hash"}}}
+	sessionStore := newMockSessionStore()
+	outbox := mailer.NewOutboxMailer(t.TempDir(), "shop@example.com")
+	handler := NewHandler(userStore, sessionStore, outbox, newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	post := func(path string, handlerFunc http.HandlerFunc, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(path, handlerFunc)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should not send anything for an unknown email", func(t *testing.T) {
+		rr := post("/password/forgot", handler.handleForgotPassword, types.ForgotPasswordPayload{Email: "nobody@example.com"})
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		if emails, _ := outbox.Messages(); len(emails) != 0 {
+			t.Errorf("expected no email, got %d", len(emails))
+		}
+	})
+
+	t.Run("should reset the password once with the emailed token", func(t *testing.T) {
+		sessionStore.add("session-token", "user-session", time.Now().Add(time.Hour))
+
+		rr := post("/password/forgot", handler.handleForgotPassword, types.ForgotPasswordPayload{Email: "user@example.com"})
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		emails, _ := outbox.Messages()
+		if len(emails) != 1 || emails[0].To != "user@example.com" {
+			t.Fatalf("expected one email to the user, got %+v", emails)
+		}
+		token := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(emails[0].Body)
+		if token == nil {
+			t.Fatalf("expected a reset link in %q", emails[0].Body)
+		}
+
+		payload := types.ResetPasswordPayload{Token: token[1], Password: "a-new-password"}
+		if rr := post("/password/reset", handler.handleResetPassword, payload); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !auth.ComparePasswords(userStore.users[0].Password, []byte("a-new-password")) {
+			t.Errorf("expected the password to be changed")
+		}
+		if active, _ := sessionStore.IsSessionActive("user-session"); active {
+			t.Errorf("expected existing sessions to be revoked")
+		}
+
+		if rr := post("/password/reset", handler.handleResetPassword, payload); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should fail with an unknown token", func(t *testing.T) {
+		payload := types.ResetPasswordPayload{Token: "unknown", Password: "a-new-password"}
+		if rr := post("/password/reset", handler.handleResetPassword, payload); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
 }
 
-type mockUserStore struct{}
+func TestEmailVerificationHandler(t *testing.T) {
+	userStore := &mockUserStore{}
+	outbox := mailer.NewOutboxMailer(t.TempDir(), "shop@example.com")
+	handler := NewHandler(userStore, newMockSessionStore(), outbox, newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/register", handler.handleRegister)
+	router.HandleFunc("/login", handler.handleLogin)
+	router.HandleFunc("/verify-email", handler.handleVerifyEmail)
+	router.HandleFunc("/verify-email/resend", handler.handleResendVerification)
+
+	serve := func(method, path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	login := types.LoginUserPayload{Email: "new@example.com", Password: "asdfgasdfasdf"}
+
+	rr := serve(http.MethodPost, "/register", types.RegisterUserPayload{
+		FirstName: "new",
+		LastName: "user",
+		Email: "new@example.com",
+		Password: "asdfgasdfasdf",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	emails, _ := outbox.Messages()
+	if len(emails) != 1 || emails[0].To != "new@example.com" {
+		t.Fatalf("expected a verification email, got %+v", emails)
+	}
+	link := regexp.MustCompile(`/api/v1(/verify-email\?token=\S+)`).FindStringSubmatch(emails[0].Body)
+	if link == nil {
+		t.Fatalf("expected a verification link in %q", emails[0].Body)
+	}
+
+	t.Run("should throttle resends", func(t *testing.T) {
+		if rr := serve(http.MethodPost, "/verify-email/resend", types.ResendVerificationPayload{Email: "new@example.com"}); rr.Code != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		if emails, _ := outbox.Messages(); len(emails) != 1 {
+			t.Errorf("expected no new email within the resend interval, got %d", len(emails))
+		}
+	})
+
+	t.Run("should refuse unverified users when configured", func(t *testing.T) {
+		config.Envs.RequireVerifiedEmailForLogin = true
+		defer func() { config.Envs.RequireVerifiedEmailForLogin = false }()
+
+		if rr := serve(http.MethodPost, "/login", login); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject a tampered link", func(t *testing.T) {
+		if rr := serve(http.MethodGet, link[1]+"x", nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should verify the email with the link", func(t *testing.T) {
+		userStore.guestOrders = map[string]int{"new@example.com": 2, "other@example.com": 1}
+		if rr := serve(http.MethodGet, link[1], nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[0].VerifiedAt == nil {
+			t.Errorf("expected user to be verified")
+		}
+		if _, ok := userStore.guestOrders["new@example.com"]; ok || len(userStore.guestOrders) != 1 {
+			t.Errorf("expected only the guest orders of the verified email to be claimed, left %v", userStore.guestOrders)
+		}
+
+		config.Envs.RequireVerifiedEmailForLogin = true
+		defer func() { config.Envs.RequireVerifiedEmailForLogin = false }()
+
+		if rr := serve(http.MethodPost, "/login", login); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestTwoFactorHandler(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{{ID: 1, Email: "user@example.com", Password: hashed}}}
+	handler := NewHandler(userStore, newMockSessionStore(), mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	serve := func(handlerFunc http.HandlerFunc, payload any) (*httptest.ResponseRecorder, map[string]any) {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handlerFunc(rr, req)
+
+		var res map[string]any
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		return rr, res
+	}
+	login := types.LoginUserPayload{Email: "user@example.com", Password: "asdfgasdfasdf"}
+
+	rr, res := serve(handler.handleTwoFactorEnroll, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	secret, _ := res["secret"].(string)
+	if secret == "" || !strings.HasPrefix(res["qrCode"].(string), "data:image/png;base64,") {
+		t.Fatalf("unexpected enrollment response %v", res)
+	}
+
+	t.Run("should not enable 2FA with a wrong code", func(t *testing.T) {
+		if rr, _ := serve(handler.handleTwoFactorConfirm, types.TOTPCodePayload{Code: "000000"}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if rr, res := serve(handler.handleLogin, login); rr.Code != http.StatusOK || res["token"] == nil {
+			t.Errorf("expected a normal login, got %d %v", rr.Code, res)
+		}
+	})
+
+	code, _ := auth.TOTPCode(secret, time.Now())
+	rr, res = serve(handler.handleTwoFactorConfirm, types.TOTPCodePayload{Code: code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	recoveryCodes, _ := res["recoveryCodes"].([]any)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %v", res)
+	}
+
+	challenge := func() string {
+		rr, res := serve(handler.handleLogin, login)
+		if rr.Code != http.StatusOK || res["twoFactorRequired"] != true || res["token"] != nil {
+			t.Fatalf("expected a 2FA challenge, got %d %v", rr.Code, res)
+		}
+		return res["challengeToken"].(string)
+	}
+
+	t.Run("should not accept a code twice", func(t *testing.T) {
+		payload := types.TwoFactorLoginPayload{ChallengeToken: challenge(), Code: code}
+		if rr, _ := serve(handler.handleTwoFactorLogin, payload); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should log in with the next code", func(t *testing.T) {
+		next, _ := auth.TOTPCode(secret, time.Now().Add(30*time.Second))
+		payload := types.TwoFactorLoginPayload{ChallengeToken: challenge(), Code: next}
+		if rr, res := serve(handler.handleTwoFactorLogin, payload); rr.Code != http.StatusOK || res["token"] == nil {
+			t.Errorf("expected tokens, got %d %v", rr.Code, res)
+		}
+	})
+
+	t.Run("should log in once with a recovery code", func(t *testing.T) {
+		payload := types.TwoFactorLoginPayload{ChallengeToken: challenge(), RecoveryCode: strings.ToUpper(recoveryCodes[0].(string))}
+		if rr, res := serve(handler.handleTwoFactorLogin, payload); rr.Code != http.StatusOK || res["token"] == nil {
+			t.Errorf("expected tokens, got %d %v", rr.Code, res)
+		}
+		if rr, _ := serve(handler.handleTwoFactorLogin, payload); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should reject an invalid challenge", func(t *testing.T) {
+		payload := types.TwoFactorLoginPayload{ChallengeToken: "invalid", RecoveryCode: recoveryCodes[1].(string)}
+		if rr, _ := serve(handler.handleTwoFactorLogin, payload); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should disable 2FA with a recovery code", func(t *testing.T) {
+		if rr, _ := serve(handler.handleTwoFactorDisable, types.TOTPCodePayload{Code: recoveryCodes[2].(string)}); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if rr, res := serve(handler.handleLogin, login); rr.Code != http.StatusOK || res["token"] == nil {
+			t.Errorf("expected a normal login, got %d %v", rr.Code, res)
+		}
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{{ID: 1, Email: "user@example.com", Password: hashed}}}
+	accountLimiter := auth.NewMemoryLoginLimiter(3, 5, time.Minute)
+	ipLimiter := auth.NewMemoryLoginLimiter(20, 100, time.Minute)
+	handler := NewHandler(userStore, newMockSessionStore(), mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), accountLimiter, ipLimiter, &mockAuditStore{}, &mockExportStore{})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.LoginUserPayload{Email: "user@example.com", Password: password})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		handler.handleLogin(rr, req)
+		return rr
+	}
+
+	t.Run("should throttle after repeated failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if rr := login("wrongpassword"); rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		}
+		rr := login("asdfgasdfasdf")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Errorf("expected a Retry-After header")
+		}
+	})
+
+	t.Run("should record the attempts", func(t *testing.T) {
+		if len(userStore.attempts) != 4 {
+			t.Fatalf("expected 4 attempts, got %d", len(userStore.attempts))
+		}
+		first, last := userStore.attempts[0], userStore.attempts[3]
+		if first.UserID != 1 || first.IP != "192.0.2.1" || first.Reason != types.LoginReasonInvalidCredentials {
+			t.Errorf("unexpected attempt %+v", first)
+		}
+		if last.Success || last.Reason != types.LoginReasonThrottled {
+			t.Errorf("unexpected attempt %+v", last)
+		}
+	})
+
+	t.Run("should log in again once an admin unlocked the account", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/admin/users/1/lockout", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/users/{userID}/lockout", handler.handleUnlockUser)
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if rr := login("asdfgasdfasdf"); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestPasswordRehash(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("asdfgasdfasdf"), bcrypt.MinCost)
+	userStore := &mockUserStore{users: []types.User{{ID: 1, Email: "user@example.com", Password: string(legacy)}}}
+	handler := NewHandler(userStore, newMockSessionStore(), mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(types.LoginUserPayload{Email: "user@example.com", Password: password})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.handleLogin(rr, req)
+		return rr
+	}
+
+	t.Run("should keep the old hash on a failed login", func(t *testing.T) {
+		if rr := login("wrongpassword"); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if userStore.users[0].Password != string(legacy) {
+			t.Errorf("expected the bcrypt hash to be kept")
+		}
+	})
+
+	t.Run("should upgrade a bcrypt hash on login", func(t *testing.T) {
+		if rr := login("asdfgasdfasdf"); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		upgraded := userStore.users[0].Password
+		if !strings.HasPrefix(upgraded, "$argon2id$") {
+			t.Fatalf("expected an argon2id hash, got %s", upgraded)
+		}
+		if rr := login("asdfgasdfasdf"); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[0].Password != upgraded {
+			t.Errorf("expected a current hash to be left alone")
+		}
+	})
+}
+
+func TestProfileHandler(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	now := time.Now()
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, FirstName: "user", LastName: "asdf", Email: "user@example.com", Password: hashed, VerifiedAt: &now},
+		{ID: 2, Email: "taken@example.com"},
+	}}
+	sessionStore := newMockSessionStore()
+	sessionStore.add("current-token", "current-session", time.Now().Add(time.Hour))
+	outbox := mailer.NewOutboxMailer(t.TempDir(), "shop@example.com")
+	handler := NewHandler(userStore, sessionStore, outbox, newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	serve := func(handlerFunc http.HandlerFunc, payload any) (*httptest.ResponseRecorder, map[string]any) {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPost, "/me", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handlerFunc(rr, req)
+
+		var res map[string]any
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		return rr, res
+	}
+	str := func(s string) *string { return &s }
+
+	t.Run("should return the current user without secrets", func(t *testing.T) {
+		rr, res := serve(handler.handleGetMe, nil)
+		if rr.Code != http.StatusOK || res["email"] != "user@example.com" {
+			t.Fatalf("unexpected response %d %v", rr.Code, res)
+		}
+		if _, ok := res["password"]; ok {
+			t.Errorf("expected no password in %v", res)
+		}
+	})
+
+	t.Run("should update the name only", func(t *testing.T) {
+		rr, _ := serve(handler.handleUpdateMe, types.UpdateProfilePayload{FirstName: str("changed")})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if u := userStore.users[0]; u.FirstName != "changed" || u.LastName != "asdf" {
+			t.Errorf("unexpected user %+v", u)
+		}
+	})
+
+	t.Run("should need the current password to change the email", func(t *testing.T) {
+		if rr, _ := serve(handler.handleUpdateMe, types.UpdateProfilePayload{Email: str("new@example.com")}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		payload := types.UpdateProfilePayload{FirstName: str("refused"), Email: str("new@example.com"), CurrentPassword: "wrongpassword"}
+		if rr, _ := serve(handler.handleUpdateMe, payload); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if u := userStore.users[0]; u.FirstName != "changed" || u.Email != "user@example.com" {
+			t.Errorf("expected a refused change to leave the user as it was, got %+v", u)
+		}
+	})
+
+	t.Run("should refuse an email that is taken", func(t *testing.T) {
+		payload := types.UpdateProfilePayload{FirstName: str("refused"), Email: str("taken@example.com"), CurrentPassword: "asdfgasdfasdf"}
+		if rr, _ := serve(handler.handleUpdateMe, payload); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if u := userStore.users[0]; u.FirstName != "changed" {
+			t.Errorf("expected the name to stay, got %+v", u)
+		}
+	})
+
+	t.Run("should change the email and verify it again", func(t *testing.T) {
+		payload := types.UpdateProfilePayload{Email: str("new@example.com"), CurrentPassword: "asdfgasdfasdf"}
+		if rr, _ := serve(handler.handleUpdateMe, payload); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if u := userStore.users[0]; u.Email != "new@example.com" || u.VerifiedAt != nil {
+			t.Errorf("unexpected user %+v", u)
+		}
+
+		emails, _ := outbox.Messages()
+		to := map[string]bool{}
+		for _, email := range emails {
+			to[email.To] = true
+		}
+		if !to["new@example.com"] || !to["user@example.com"] {
+			t.Errorf("expected a verification link and a notice to the old address, got %+v", emails)
+		}
+	})
+
+	t.Run("should refuse a wrong current password", func(t *testing.T) {
+		payload := types.ChangePasswordPayload{CurrentPassword: "wrongpassword", NewPassword: "newpassword"}
+		if rr, _ := serve(handler.handleChangePassword, payload); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should change the password and revoke the other sessions", func(t *testing.T) {
+		payload := types.ChangePasswordPayload{CurrentPassword: "asdfgasdfasdf", NewPassword: "newpassword"}
+		rr, res := serve(handler.handleChangePassword, payload)
+		if rr.Code != http.StatusOK || res["token"] == nil {
+			t.Fatalf("expected new tokens, got %d %v", rr.Code, res)
+		}
+		if !auth.ComparePasswords(userStore.users[0].Password, []byte("newpassword")) {
+			t.Errorf("expected the password to be changed")
+		}
+		if active, _ := sessionStore.IsSessionActive("current-session"); active {
+			t.Errorf("expected the old session to be revoked")
+		}
+	})
+}
+
+func TestDeleteAccountHandler(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, FirstName: "user", LastName: "asdf", Email: "user@example.com", Password: hashed},
+		{ID: 2, FirstName: "other", LastName: "asdf", Email: "other@example.com", Password: hashed},
+		{ID: 3, Email: "admin@example.com", Role: types.RoleAdmin},
+		{ID: 4, FirstName: "oidc", Email: "oidc@example.com"},
+	}}
+	sessionStore := newMockSessionStore()
+	sessionStore.add("user-token", "user-session", time.Now().Add(time.Hour))
+	auditStore := &mockAuditStore{}
+	exportStore := &mockExportStore{}
+	handler := NewHandler(userStore, sessionStore, mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), auditStore, exportStore)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/me", handler.handleDeleteMe)
+	router.HandleFunc("/admin/users/{userID}", handler.handleDeleteUser)
+
+	serve := func(path string, userID int, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodDelete, path, bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should need the current password", func(t *testing.T) {
+		if rr := serve("/me", 1, types.DeleteAccountPayload{CurrentPassword: "wrongpassword"}); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if userStore.users[0].DeletedAt != nil {
+			t.Errorf("expected the user to be kept")
+		}
+	})
+
+	t.Run("should ask an account without a password to set one first", func(t *testing.T) {
+		// more tries than the limiter allows, none of them count as a failed login
+		for i := 0; i < 4; i++ {
+			rr := serve("/me", 4, types.DeleteAccountPayload{CurrentPassword: "anything"})
+			if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "/password/forgot") {
+				t.Fatalf("expected to be asked to set a password, got %d %s", rr.Code, rr.Body.String())
+			}
+		}
+		if userStore.users[3].DeletedAt != nil {
+			t.Errorf("expected the user to be kept")
+		}
+	})
+
+	t.Run("should anonymize the user and revoke the sessions", func(t *testing.T) {
+		if rr := serve("/me", 1, types.DeleteAccountPayload{CurrentPassword: "asdfgasdfasdf"}); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if u := userStore.users[0]; u.DeletedAt == nil || u.Email == "user@example.com" || u.Password != "" {
+			t.Errorf("expected the user to be anonymized, got %+v", u)
+		}
+		if active, _ := sessionStore.IsSessionActive("user-session"); active {
+			t.Errorf("expected the session to be revoked")
+		}
+		if len(auditStore.entries) != 1 || auditStore.entries[0].ActorID != 1 || auditStore.entries[0].TargetID != "1" {
+			t.Errorf("unexpected audit entries %+v", auditStore.entries)
+		}
+		if fmt.Sprint(exportStore.deleted) != "[1]" {
+			t.Errorf("expected the exports of user 1 to be deleted, got %v", exportStore.deleted)
+		}
+	})
+
+	t.Run("should let an admin delete a user", func(t *testing.T) {
+		if rr := serve("/admin/users/2", 3, nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[1].DeletedAt == nil {
+			t.Errorf("expected the user to be deleted")
+		}
+		if fmt.Sprint(exportStore.deleted) != "[1 2]" {
+			t.Errorf("expected the exports of user 2 to be deleted, got %v", exportStore.deleted)
+		}
+		if last := auditStore.entries[len(auditStore.entries)-1]; last.ActorID != 3 || last.TargetID != "2" {
+			t.Errorf("unexpected audit entry %+v", last)
+		}
+	})
+
+	t.Run("should not delete a user twice or the admin themselves", func(t *testing.T) {
+		if rr := serve("/admin/users/2", 3, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve("/admin/users/3", 3, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestSessionsHandler(t *testing.T) {
+	hashed, _ := auth.HashPassword("asdfgasdfasdf")
+	userStore := &mockUserStore{users: []types.User{{ID: 1, Email: "user@example.com", Password: hashed}}}
+	sessionStore := newMockSessionStore()
+	handler := NewHandler(userStore, sessionStore, mailer.NewOutboxMailer(t.TempDir(), "shop@example.com"), newTestLimiter(), newTestLimiter(), &mockAuditStore{}, &mockExportStore{})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/login", handler.handleLogin)
+	router.HandleFunc("/me/sessions", handler.handleGetSessions).Methods(http.MethodGet)
+	router.HandleFunc("/me/sessions", handler.handleRevokeAllSessions).Methods(http.MethodDelete)
+	router.HandleFunc("/me/sessions/{sessionID}", handler.handleRevokeSession).Methods(http.MethodDelete)
+
+	// log in from a device, returns its session ID
+	login := func(userAgent string) string {
+		marshalled, _ := json.Marshal(types.LoginUserPayload{Email: "user@example.com", Password: "asdfgasdfasdf"})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		for id, session := range sessionStore.sessions {
+			if session.UserAgent == userAgent {
+				return id
+			}
+		}
+		t.Fatalf("expected a session for %s", userAgent)
+		return ""
+	}
+	serve := func(method, path, sessionID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.WithValue(req.Context(), auth.UserKey, 1)
+		ctx = context.WithValue(ctx, auth.SessionKey, sessionID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+	list := func(sessionID string) []types.Session {
+		rr := serve(http.MethodGet, "/me/sessions", sessionID)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var sessions []types.Session
+		json.NewDecoder(rr.Body).Decode(&sessions)
+		return sessions
+	}
+
+	laptop := login("laptop")
+	phone := login("phone")
+
+	t.Run("should list the devices and mark the current one", func(t *testing.T) {
+		sessions := list(laptop)
+		if len(sessions) != 2 {
+			t.Fatalf("expected 2 sessions, got %d", len(sessions))
+		}
+		for _, session := range sessions {
+			if session.Current != (session.ID == laptop) || session.IP != "192.0.2.1" {
+				t.Errorf("unexpected session %+v", session)
+			}
+		}
+	})
+
+	t.Run("should not revoke the session of another user", func(t *testing.T) {
+		sessionStore.CreateSession(types.Session{ID: "other", UserID: 2})
+		if rr := serve(http.MethodDelete, "/me/sessions/other", laptop); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should revoke a device", func(t *testing.T) {
+		if rr := serve(http.MethodDelete, "/me/sessions/"+phone, laptop); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if sessions := list(laptop); len(sessions) != 1 || sessions[0].ID != laptop {
+			t.Errorf("expected only the laptop to be left, got %+v", sessions)
+		}
+	})
+
+	t.Run("should log out everywhere", func(t *testing.T) {
+		if rr := serve(http.MethodDelete, "/me/sessions", laptop); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if sessions := list(laptop); len(sessions) != 0 {
+			t.Errorf("expected no sessions, got %+v", sessions)
+		}
+	})
+}
+
+func newTestLimiter() *auth.MemoryLoginLimiter {
+	return auth.NewMemoryLoginLimiter(3, 10, time.Minute)
+}
+
+type mockUserStore struct {
+	users  []types.User
+	resets []types.PasswordReset
+	// recovery code hash => used
+	recoveryCodes map[string]bool
+	attempts []types.LoginAttempt
+	identities []types.UserIdentity
+	// email => unclaimed guest orders
+	guestOrders map[string]int
+}
 
 // implement mockUserStore the same as UserStore in types.go
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	for i := range m.users {
+		if m.users[i].Email == email {
+			return &m.users[i], nil
+		}
+	}
 	return nil, fmt.Errorf("user not found")
 }
 
 func (m *mockUserStore) GetUserByID(id int) (*types.User, error){
-	return nil, nil
+	for i := range m.users {
+		if m.users[i].ID == id {
+			// a copy, like a row read from the database
+			u := m.users[i]
+			return &u, nil
+		}
+	}
+	return &types.User{ID: id, Role: types.RoleCustomer}, nil
 }
 
 func (m *mockUserStore) CreateUser(user types.User) error{
+	user.ID = len(m.users) + 1
+	m.users = append(m.users, user)
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfile(userID int, firstName, lastName, email string) error {
+	if u := m.user(userID); u != nil {
+		u.FirstName = firstName
+		u.LastName = lastName
+		if !strings.EqualFold(u.Email, email) {
+			u.Email = email
+			u.VerifiedAt = nil
+			u.VerificationSentAt = nil
+		}
+	}
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	if u := m.user(userID); u != nil {
+		u.Password = passwordHash
+	}
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	if u := m.user(userID); u != nil {
+		now := time.Now()
+		*u = types.User{
+			ID: u.ID,
+			FirstName: "Deleted",
+			LastName: "User",
+			Email: fmt.Sprintf("deleted-%d@deleted.invalid", u.ID),
+			CreatedAt: u.CreatedAt,
+			Role: u.Role,
+			DeletedAt: &now,
+		}
+	}
+	return nil
+}
+
+func (m *mockUserStore) GetUserByIdentity(provider, subject string) (*types.User, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return m.user(identity.UserID), nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) CreateUserIdentity(identity types.UserIdentity) error {
+	identity.ID = len(m.identities) + 1
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(userID int) error {
+	now := time.Now()
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].VerifiedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockUserStore) ClaimGuestOrders(userID int, email string) (int, error) {
+	claimed := m.guestOrders[email]
+	delete(m.guestOrders, email)
+	return claimed, nil
+}
+
+func (m *mockUserStore) MarkVerificationSent(userID int) error {
+	now := time.Now()
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].VerificationSentAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockUserStore) user(userID int) *types.User {
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			return &m.users[i]
+		}
+	}
+	return &types.User{}
+}
+
+func (m *mockUserStore) SetTOTPSecret(userID int, secret string) error {
+	m.user(userID).TOTPSecret = secret
+	m.user(userID).TOTPLastStep = 0
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(userID int, recoveryCodeHashes []string) error {
+	now := time.Now()
+	m.user(userID).TOTPEnabledAt = &now
+	m.recoveryCodes = make(map[string]bool)
+	for _, codeHash := range recoveryCodeHashes {
+		m.recoveryCodes[codeHash] = false
+	}
+	return nil
+}
+
+func (m *mockUserStore) DisableTOTP(userID int) error {
+	m.user(userID).TOTPSecret = ""
+	m.user(userID).TOTPEnabledAt = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func (m *mockUserStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	u := m.user(userID)
+	if u.TOTPLastStep >= step {
+		return false, nil
+	}
+	u.TOTPLastStep = step
+	return true, nil
+}
+
+func (m *mockUserStore) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	used, ok := m.recoveryCodes[codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[codeHash] = true
+	return true, nil
+}
+
+func (m *mockUserStore) CreatePasswordReset(reset types.PasswordReset) error {
+	reset.ID = len(m.resets) + 1
+	m.resets = append(m.resets, reset)
+	return nil
+}
+
+func (m *mockUserStore) GetPasswordResetByHash(tokenHash string) (*types.PasswordReset, error) {
+	for _, reset := range m.resets {
+		if reset.TokenHash == tokenHash {
+			return &reset, nil
+		}
+	}
+	return nil, fmt.Errorf("password reset not found")
+}
+
+func (m *mockUserStore) ResetPassword(reset types.PasswordReset, passwordHash string) error {
+	for i := range m.resets {
+		if m.resets[i].ID == reset.ID {
+			if m.resets[i].UsedAt != nil {
+				return types.ErrPasswordResetUsed
+			}
+			now := time.Now()
+			m.resets[i].UsedAt = &now
+		}
+	}
+	for i := range m.users {
+		if m.users[i].ID == reset.UserID {
+			m.users[i].Password = passwordHash
+		}
+	}
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(attempt types.LoginAttempt) error {
+	attempt.ID = len(m.attempts) + 1
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+func (m *mockUserStore) GetLoginAttempts(filter types.LoginAttemptFilter) ([]types.LoginAttempt, error) {
+	return m.attempts, nil
+}
+
+// only the query and the suspension are filtered, enough for the handlers
+func (m *mockUserStore) GetUsers(filter types.UserFilter) ([]types.User, int, error) {
+	matches := make([]types.User, 0)
+	for _, u := range m.users {
+		if filter.Query != "" && !strings.Contains(u.Email, filter.Query) {
+			continue
+		}
+		if filter.Suspended != nil && *filter.Suspended != (u.SuspendedAt != nil) {
+			continue
+		}
+		matches = append(matches, u)
+	}
+	end := filter.Offset + filter.Limit
+	if filter.Offset > len(matches) {
+		return []types.User{}, len(matches), nil
+	}
+	if end > len(matches) {
+		end = len(matches)
+	}
+	return matches[filter.Offset:end], len(matches), nil
+}
+
+func (m *mockUserStore) GetUserStats(userID int) (*types.UserStats, error) {
+	return &types.UserStats{OrderCount: 2, LifetimeSpend: 30}, nil
+}
+
+func (m *mockUserStore) SetUserSuspended(userID int, suspendedAt *time.Time) error {
+	if u := m.user(userID); u != nil {
+		u.SuspendedAt = suspendedAt
+	}
+	return nil
+}
+
+type mockAuditStore struct {
+	entries []types.AuditEntry
+}
+
+func (m *mockAuditStore) CreateAuditEntry(entry types.AuditEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// in memory SessionStore, tokens keyed by hash and sessions by ID
+type mockSessionStore struct {
+	tokens map[string]*types.RefreshToken
+	sessions map[string]*types.Session
+}
+
+func newMockSessionStore() *mockSessionStore {
+	return &mockSessionStore{tokens: make(map[string]*types.RefreshToken), sessions: make(map[string]*types.Session)}
+}
+
+func (m *mockSessionStore) add(token, sessionID string, expiresAt time.Time) {
+	m.CreateRefreshToken(types.RefreshToken{
+		UserID: 1,
+		SessionID: sessionID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (m *mockSessionStore) CreateRefreshToken(token types.RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens[token.TokenHash] = &token
+	return nil
+}
+
+func (m *mockSessionStore) GetRefreshTokenByHash(tokenHash string) (*types.RefreshToken, error) {
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("refresh token not found")
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (m *mockSessionStore) RotateRefreshToken(oldID int, next types.RefreshToken) error {
+	for _, token := range m.tokens {
+		if token.ID == oldID {
+			if token.RevokedAt != nil {
+				return types.ErrRefreshTokenReused
+			}
+			now := time.Now()
+			token.RevokedAt = &now
+		}
+	}
+	return m.CreateRefreshToken(next)
+}
+
+func (m *mockSessionStore) RevokeSession(sessionID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.SessionID == sessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) RevokeUserSessions(userID int) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) IsSessionActive(sessionID string) (bool, error) {
+	for _, token := range m.tokens {
+		if token.SessionID == sessionID && token.RevokedAt == nil && token.ExpiresAt.After(time.Now()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockSessionStore) CreateSession(session types.Session) error {
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	m.sessions[session.ID] = &session
+	return nil
+}
+
+func (m *mockSessionStore) GetSessionByID(sessionID string) (*types.Session, error) {
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *mockSessionStore) GetActiveSessionsByUserID(userID int) ([]types.Session, error) {
+	sessions := make([]types.Session, 0)
+	for _, session := range m.sessions {
+		if active, _ := m.IsSessionActive(session.ID); active && session.UserID == userID {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionStore) TouchSession(sessionID string, lastSeenAt time.Time) error {
+	if session, ok := m.sessions[sessionID]; ok {
+		session.LastSeenAt = lastSeenAt
+	}
+	return nil
+}
+
+// remembers whose exports were deleted
+type mockExportStore struct {
+	types.DataExportStore
+	deleted []int
+}
+
+func (m *mockExportStore) DeleteUserExports(userID int) error {
+	m.deleted = append(m.deleted, userID)
 	return nil
 }
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/gorilla/mux"
+)
+
+// the devices the user is logged in on
+func (h *Handler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.sessionStore.GetActiveSessionsByUserID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	current := auth.GetSessionIDFromContext(r.Context())
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+// log a device out, its access token stops working right away
+func (h *Handler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sessionStore.GetSessionByID(mux.Vars(r)["sessionID"])
+	// someone else's session is as good as a missing one
+	if err != nil || session.UserID != auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("session not found"))
+		return
+	}
+
+	if err := h.sessionStore.RevokeSession(session.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "session revoked"})
+}
+
+// log out everywhere, including the current session
+func (h *Handler) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if err := h.sessionStore.RevokeUserSessions(auth.GetUserIDFromContext(r.Context())); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "logged out everywhere"})
+}
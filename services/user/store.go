@@ -5,6 +5,9 @@ package user
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/faldeus0092/go-ecom/types"
 )
@@ -59,13 +62,431 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 }
 
 func (s *Store) CreateUser(user types.User) (error) {
-	_, err := s.db.Exec("INSERT INTO users (firstName, lastName, email, password) VALUES (?, ?, ?, ?)", user.FirstName, user.LastName, user.Email, user.Password)
+	if user.Role == "" {
+		user.Role = types.RoleCustomer
+	}
+	_, err := s.db.Exec("INSERT INTO users (firstName, lastName, email, password, role) VALUES (?, ?, ?, ?, ?)", user.FirstName, user.LastName, user.Email, user.Password, user.Role)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (s *Store) UpdateUserRole(userID int, role string) error {
+	_, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
+func (s *Store) MarkEmailVerified(userID int) error {
+	_, err := s.db.Exec("UPDATE users SET verifiedAt = now() WHERE id = ? AND verifiedAt IS NULL", userID)
+	return err
+}
+
+// a changed email has to be verified again, the email is set last so the checks still see the old one
+func (s *Store) UpdateUserProfile(userID int, firstName, lastName, email string) error {
+	_, err := s.db.Exec(`UPDATE users SET firstName = ?, lastName = ?,
+			verifiedAt = IF(email = ?, verifiedAt, NULL),
+			verificationSentAt = IF(email = ?, verificationSentAt, NULL),
+			email = ?
+		WHERE id = ?`, firstName, lastName, email, email, email, userID)
+	return err
+}
+
+func (s *Store) UpdatePassword(userID int, passwordHash string) error {
+	_, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, userID)
+	return err
+}
+
+/* Attach the orders of the guest customer with this email to the user.
+*	only called once the user proved the email is theirs, the guest customer stays linked
+*	so later guest orders with the email can be found too
+ */
+func (s *Store) ClaimGuestOrders(userID int, email string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE guest_customers SET userId = ? WHERE email = ?", userID, email); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`UPDATE orders JOIN guest_customers ON guest_customers.id = orders.guestCustomerId
+		SET orders.userId = ? WHERE guest_customers.email = ? AND orders.userId IS NULL`, userID, email)
+	if err != nil {
+		return 0, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(claimed), tx.Commit()
+}
+
+/* Anonymize the user in one transaction.
+*	the email stays unique and can't be logged in with, the empty password hash never matches.
+*	orders keep their totals and items, only the addresses are scrubbed
+ */
+func (s *Store) AnonymizeUser(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	email := fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+	_, err = tx.Exec(`UPDATE users SET firstName = 'Deleted', lastName = 'User', email = ?, password = '',
+		verifiedAt = NULL, verificationSentAt = NULL, totpSecret = '', totpEnabledAt = NULL, deletedAt = now()
+		WHERE id = ?`, email, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE orders SET address = '', shippingAddress = NULL WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE guest_customers SET email = CONCAT('deleted-guest-', id, '@deleted.invalid') WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE login_attempts SET email = ?, ip = '', userAgent = '' WHERE userId = ?", email, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sessions SET userAgent = '', ip = '' WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM addresses WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	// signing in with the provider again starts a new account
+	if _, err := tx.Exec("DELETE FROM user_identities WHERE userId = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetUserByIdentity(provider, subject string) (*types.User, error) {
+	rows, err := s.db.Query("SELECT users.* FROM users JOIN user_identities ON user_identities.userId = users.id WHERE user_identities.provider = ? AND user_identities.subject = ?", provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	u := new(types.User)
+	for rows.Next() {
+		u, err = scanRowIntoUser(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.ID == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return u, nil
+}
+
+func (s *Store) CreateUserIdentity(identity types.UserIdentity) error {
+	_, err := s.db.Exec("INSERT INTO user_identities (userId, provider, subject, email) VALUES (?, ?, ?, ?)",
+		identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	return err
+}
+
+// remember when the last verification email went out, for throttling resends
+func (s *Store) MarkVerificationSent(userID int) error {
+	_, err := s.db.Exec("UPDATE users SET verificationSentAt = ? WHERE id = ?", time.Now(), userID)
+	return err
+}
+
+// store the secret of a pending enrollment, it does nothing until EnableTOTP
+func (s *Store) SetTOTPSecret(userID int, secret string) error {
+	_, err := s.db.Exec("UPDATE users SET totpSecret = ?, totpLastStep = 0 WHERE id = ? AND totpEnabledAt IS NULL", secret, userID)
+	return err
+}
+
+// turn 2FA on and replace the recovery codes
+func (s *Store) EnableTOTP(userID int, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totpEnabledAt = now() WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (userId, codeHash) VALUES (?, ?)", userID, codeHash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) DisableTOTP(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totpSecret = '', totpEnabledAt = NULL, totpLastStep = 0 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// a TOTP code can only be used once, so only time steps after the last used one are accepted
+func (s *Store) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := s.db.Exec("UPDATE users SET totpLastStep = ? WHERE id = ? AND totpLastStep < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *Store) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	res, err := s.db.Exec("UPDATE recovery_codes SET usedAt = now() WHERE userId = ? AND codeHash = ? AND usedAt IS NULL", userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *Store) CreatePasswordReset(reset types.PasswordReset) error {
+	_, err := s.db.Exec("INSERT INTO password_resets (userId, tokenHash, expiresAt) VALUES (?, ?, ?)", reset.UserID, reset.TokenHash, reset.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetPasswordResetByHash(tokenHash string) (*types.PasswordReset, error) {
+	rows, err := s.db.Query("SELECT * FROM password_resets WHERE tokenHash = ?", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reset := new(types.PasswordReset)
+	for rows.Next() {
+		reset, err = scanRowIntoPasswordReset(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reset.ID == 0 {
+		return nil, fmt.Errorf("password reset not found")
+	}
+
+	return reset, nil
+}
+
+/* Use the reset token and change the password in one transaction, so a token
+*	can't change the password twice. also burns the other pending tokens of the user
+ */
+func (s *Store) ResetPassword(reset types.PasswordReset, passwordHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE password_resets SET usedAt = now() WHERE id = ? AND usedAt IS NULL", reset.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return types.ErrPasswordResetUsed
+	}
+
+	if _, err := tx.Exec("UPDATE password_resets SET usedAt = now() WHERE userId = ? AND usedAt IS NULL", reset.UserID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, reset.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RecordLoginAttempt(attempt types.LoginAttempt) error {
+	userID := sql.NullInt64{Int64: int64(attempt.UserID), Valid: attempt.UserID != 0}
+	_, err := s.db.Exec("INSERT INTO login_attempts (userId, email, ip, userAgent, success, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, attempt.Email, attempt.IP, truncate(attempt.UserAgent, 255), attempt.Success, attempt.Reason)
+	return err
+}
+
+// newest first
+func (s *Store) GetLoginAttempts(filter types.LoginAttemptFilter) ([]types.LoginAttempt, error) {
+	query := "SELECT * FROM login_attempts WHERE 1 = 1"
+	args := []interface{}{}
+	if filter.UserID != 0 {
+		query += " AND userId = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Email != "" {
+		query += " AND email = ?"
+		args = append(args, filter.Email)
+	}
+	if filter.IP != "" {
+		query += " AND ip = ?"
+		args = append(args, filter.IP)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]types.LoginAttempt, 0)
+	for rows.Next() {
+		attempt, err := scanRowIntoLoginAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, *attempt)
+	}
+	return attempts, nil
+}
+
+func (s *Store) GetUsers(filter types.UserFilter) ([]types.User, int, error) {
+	where := " WHERE deletedAt IS NULL"
+	args := []interface{}{}
+	if filter.Query != "" {
+		where += " AND (email LIKE ? OR firstName LIKE ? OR lastName LIKE ?)"
+		like := "%" + escapeLike(filter.Query) + "%"
+		args = append(args, like, like, like)
+	}
+	if filter.Role != "" {
+		where += " AND role = ?"
+		args = append(args, filter.Role)
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			where += " AND suspendedAt IS NOT NULL"
+		} else {
+			where += " AND suspendedAt IS NULL"
+		}
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT * FROM users"+where+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]types.User, 0)
+	for rows.Next() {
+		u, err := scanRowIntoUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *u)
+	}
+	return users, total, nil
+}
+
+func (s *Store) GetUserStats(userID int) (*types.UserStats, error) {
+	stats := new(types.UserStats)
+	err := s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(CASE WHEN status != 'cancelled' THEN total ELSE 0 END), 0) FROM orders WHERE userId = ?", userID).
+		Scan(&stats.OrderCount, &stats.LifetimeSpend)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *Store) SetUserSuspended(userID int, suspendedAt *time.Time) error {
+	_, err := s.db.Exec("UPDATE users SET suspendedAt = ? WHERE id = ?", suspendedAt, userID)
+	return err
+}
+
+// % and _ in a search are meant literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func scanRowIntoLoginAttempt(rows *sql.Rows) (*types.LoginAttempt, error) {
+	attempt := new(types.LoginAttempt)
+	var userID sql.NullInt64
+	err := rows.Scan(&attempt.ID,
+		&userID,
+		&attempt.Email,
+		&attempt.IP,
+		&attempt.UserAgent,
+		&attempt.Success,
+		&attempt.Reason,
+		&attempt.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	attempt.UserID = int(userID.Int64)
+
+	return attempt, nil
+}
+
+// at most max bytes, cut before a multi-byte character rather than in it
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func scanRowIntoPasswordReset(rows *sql.Rows) (*types.PasswordReset, error) {
+	reset := new(types.PasswordReset)
+	err := rows.Scan(&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+		&reset.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
 func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
 	err := rows.Scan(&user.ID, 
@@ -74,6 +495,14 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.Email, 
 		&user.Password,
 		&user.CreatedAt,
+		&user.Role,
+		&user.VerifiedAt,
+		&user.VerificationSentAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TOTPLastStep,
+		&user.DeletedAt,
+		&user.SuspendedAt,
 	)
 	if err != nil {
 		return nil, err
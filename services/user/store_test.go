@@ -0,0 +1,111 @@
+package user
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTOTPStore(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(db)
+
+	t.Run("should keep the linked identities when enabling 2FA", func(t *testing.T) {
+		recorder.statements = nil
+		if err := store.EnableTOTP(1, []string{"hash"}); err != nil {
+			t.Fatal(err)
+		}
+		recorder.assertUntouched(t, "user_identities")
+	})
+
+	t.Run("should keep the linked identities when disabling 2FA", func(t *testing.T) {
+		recorder.statements = nil
+		if err := store.DisableTOTP(1); err != nil {
+			t.Fatal(err)
+		}
+		recorder.assertUntouched(t, "user_identities")
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	t.Run("should keep strings that fit", func(t *testing.T) {
+		if got := truncate("Mozilla", 10); got != "Mozilla" {
+			t.Errorf("expected Mozilla, got %q", got)
+		}
+	})
+
+	t.Run("should not cut a character in half", func(t *testing.T) {
+		// "é" is two bytes, the limit falls between them
+		got := truncate("caféine", 4)
+		if got != "caf" || !utf8.ValidString(got) {
+			t.Errorf("expected caf, got %q", got)
+		}
+	})
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+// a database/sql driver that only remembers the statements it was given
+type recordingDriver struct {
+	statements []string
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+func (d *recordingDriver) assertUntouched(t *testing.T, table string) {
+	t.Helper()
+	if len(d.statements) == 0 {
+		t.Fatal("expected statements to be run")
+	}
+	for _, statement := range d.statements {
+		if strings.Contains(statement, table) {
+			t.Errorf("expected %s to be left alone, got %q", table, statement)
+		}
+	}
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *recordingConn) Commit() error { return nil }
+
+func (c *recordingConn) Rollback() error { return nil }
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (s *recordingStmt) Close() error { return nil }
+
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.statements = append(s.driver.statements, s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("queries are not recorded")
+}
@@ -0,0 +1,229 @@
+package user
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/faldeus0092/go-ecom/config"
+	"github.com/faldeus0092/go-ecom/services/auth"
+	"github.com/faldeus0092/go-ecom/types"
+	"github.com/faldeus0092/go-ecom/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+const recoveryCodeCount = 10
+
+/* Start (or restart) 2FA enrollment with a new secret.
+*	nothing changes for the user until the secret is confirmed with a code
+ */
+func (h *Handler) handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if u.TOTPEnabledAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.SetTOTPSecret(u.ID, secret); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	uri := auth.TOTPURI(config.Envs.AppName, u.Email, secret)
+	qrCode, err := auth.TOTPQRCode(uri)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"secret": secret,
+		"otpauthURI": uri,
+		"qrCode": "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	})
+}
+
+// prove the authenticator app was set up, then turn 2FA on and hand out the recovery codes
+func (h *Handler) handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	var payload types.TOTPCodePayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if u.TOTPEnabledAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	if u.TOTPSecret == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("start the enrollment first"))
+		return
+	}
+
+	ok, err := h.verifySecondFactor(u, payload.Code, "")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+	if err := h.store.EnableTOTP(u.ID, hashes); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the only time the recovery codes are shown
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"recoveryCodes": codes})
+}
+
+// needs a current TOTP code (or a recovery code), a stolen access token alone isn't enough
+func (h *Handler) handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	var payload types.TOTPCodePayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if u.TOTPEnabledAt == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := h.verifySecondFactor(u, payload.Code, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid code"))
+		return
+	}
+
+	if err := h.store.DisableTOTP(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "two-factor authentication disabled"})
+}
+
+// second login step, exchange the challenge token and a code for the real tokens
+func (h *Handler) handleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var payload types.TwoFactorLoginPayload
+
+	// parse
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	userID, err := auth.ValidateTwoFactorChallenge(payload.ChallengeToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired challenge, log in again"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil || u.TOTPEnabledAt == nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired challenge, log in again"))
+		return
+	}
+
+	// codes are only 6 digits, guessing them counts against the same limits as passwords
+	if h.loginThrottled(w, r, u.Email) {
+		return
+	}
+
+	ok, err := h.verifySecondFactor(u, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		h.loginFailed(r, u.ID, u.Email, types.LoginReasonInvalidCode)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid code"))
+		return
+	}
+
+	// suspended while between the two steps
+	if u.SuspendedAt != nil {
+		h.recordLoginAttempt(r, u.ID, u.Email, false, types.LoginReasonSuspended)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("account suspended"))
+		return
+	}
+
+	h.loginSucceeded(r, u)
+	h.issueTokens(w, r, u)
+}
+
+/* Check a TOTP code, falling back to a recovery code.
+*	both can only be used once, a TOTP code is burnt by moving the user's last used time step
+ */
+func (h *Handler) verifySecondFactor(u *types.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		if step, ok := auth.ValidateTOTP(u.TOTPSecret, code, time.Now()); ok {
+			return h.store.UseTOTPStep(u.ID, step)
+		}
+	}
+	if recoveryCode != "" && u.TOTPEnabledAt != nil {
+		return h.store.UseRecoveryCode(u.ID, auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)))
+	}
+	return false, nil
+}
@@ -1,13 +1,119 @@
 package types
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
 
 type UserStore interface{
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	CreateUser(user User) error
+	UpdateUserRole(userID int, role string) error
+	// name and email in one write, a changed email is marked as not verified
+	UpdateUserProfile(userID int, firstName, lastName, email string) error
+	UpdatePassword(userID int, passwordHash string) error
+	// move the orders of the guest customer with this email to the user, returns how many moved
+	ClaimGuestOrders(userID int, email string) (int, error)
+	// replace the personal data of the user and their orders, the rows stay for accounting
+	AnonymizeUser(userID int) error
+	// the user an external identity (OIDC provider + subject) is linked to
+	GetUserByIdentity(provider, subject string) (*User, error)
+	CreateUserIdentity(identity UserIdentity) error
+	CreatePasswordReset(reset PasswordReset) error
+	GetPasswordResetByHash(tokenHash string) (*PasswordReset, error)
+	ResetPassword(reset PasswordReset, passwordHash string) error
+	MarkEmailVerified(userID int) error
+	MarkVerificationSent(userID int) error
+	SetTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int, recoveryCodeHashes []string) error
+	DisableTOTP(userID int) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	RecordLoginAttempt(attempt LoginAttempt) error
+	GetLoginAttempts(filter LoginAttemptFilter) ([]LoginAttempt, error)
+	// one page of the users matching the filter, and how many match in total
+	GetUsers(filter UserFilter) ([]User, int, error)
+	GetUserStats(userID int) (*UserStats, error)
+	// nil reactivates the user
+	SetUserSuspended(userID int, suspendedAt *time.Time) error
 }
 
+// zero values don't filter, deleted users are never listed
+type UserFilter struct {
+	// part of the email, first or last name
+	Query     string
+	Role      string
+	Suspended *bool
+	Limit     int
+	Offset    int
+}
+
+// order totals of a user, cancelled orders don't count as spend
+type UserStats struct {
+	OrderCount    int     `json:"orderCount"`
+	LifetimeSpend float64 `json:"lifetimeSpend"`
+}
+
+/* Throttles login attempts per key (account or client IP).
+*	the in memory one is auth.MemoryLoginLimiter, swap it for a shared store when running several instances
+ */
+// account at an external identity provider, linked to a user for social login
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userID"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type LoginLimiter interface {
+	// how long the key has to wait before its next attempt, 0 when it can try now
+	Check(key string) time.Duration
+	// record a failed attempt, returns how long the key has to wait now
+	Fail(key string) time.Duration
+	Reset(key string)
+}
+
+const (
+	LoginReasonSuccess            = "success"
+	LoginReasonInvalidCredentials = "invalid_credentials"
+	LoginReasonInvalidCode        = "invalid_2fa_code"
+	LoginReasonThrottled          = "throttled"
+	LoginReasonUnverified         = "email_not_verified"
+	LoginReasonTwoFactorRequired  = "2fa_required"
+	LoginReasonSuspended          = "suspended"
+)
+
+// every login attempt, successful or not, for support to spot suspicious activity.
+// UserID is 0 when the email doesn't belong to anyone
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userID"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// zero values don't filter
+type LoginAttemptFilter struct {
+	UserID int
+	Email  string
+	IP     string
+	Limit  int
+}
+
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
 // for interacting with DB, make it same with table in DB
 type User struct {
 	ID        int       `json:"id"`
@@ -16,6 +122,17 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"-"`
 	CreatedAt time.Time `json:"createdAt"`
+	Role      string    `json:"role"`
+	VerifiedAt         *time.Time `json:"verifiedAt"`
+	VerificationSentAt *time.Time `json:"-"`
+	// set at enrollment, only in use once TOTPEnabledAt is set
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totpEnabledAt"`
+	TOTPLastStep  int64      `json:"-"`
+	// set once the account is deleted and anonymized
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// suspended users can't log in or use their tokens until reactivated
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty"`
 }
 
 // for register json payload
@@ -23,7 +140,208 @@ type RegisterUserPayload struct {
 	FirstName string `json:"firstName" validate:"required,min=2,max=50"`
 	LastName  string `json:"lastName" validate:"required,min=2,max=50"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=8,max=130"`
+	// length and the rest of the password policy are checked by auth.CheckPassword
+	Password  string `json:"password" validate:"required"`
+}
+
+// returned by ResetPassword when the reset token was already used
+var ErrPasswordResetUsed = errors.New("password reset already used")
+
+// like refresh tokens, only the sha256 of the reset token is stored
+type PasswordReset struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userID"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// for 2FA confirm and disable json payload
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// for the second login step json payload, either the TOTP code or a recovery code
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type DataExportStore interface {
+	CreateExport(userID int) (int, error)
+	GetExportByID(id int) (*DataExport, error)
+	// nil when the user never asked for one
+	GetLatestExportByUserID(userID int) (*DataExport, error)
+	CompleteExport(id int, filePath string, expiresAt time.Time) error
+	FailExport(id int) error
+	// removes the files of expired exports, returns how many
+	RemoveExpiredExportFiles() (int, error)
+	// removes every export of the user, files and rows
+	DeleteUserExports(userID int) error
+}
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// a personal data export, built in the background
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"userID"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// everything we hold about a user, the content of export.json
+type DataExportBundle struct {
+	ExportedAt   time.Time       `json:"exportedAt"`
+	User         User            `json:"user"`
+	Orders       []ExportedOrder `json:"orders"`
+	Addresses    []string        `json:"addresses"`
+	AddressBook  []Address       `json:"addressBook"`
+	LoginHistory []LoginAttempt  `json:"loginHistory"`
+}
+
+type ExportedOrder struct {
+	Order
+	Items []OrderItem `json:"items"`
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (int, error)
+	GetAPIKeyByID(id int) (*APIKey, error)
+	GetAPIKeyByPrefix(prefix string) (*APIKey, error)
+	GetAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id int) error
+	TouchAPIKey(id int, usedAt time.Time) error
+}
+
+// what an API key may do, users are checked by role instead
+const (
+	ScopeProductsWrite = "products:write"
+	ScopeOrdersRead    = "orders:read"
+	ScopeOrdersWrite   = "orders:write"
+)
+
+// key for server to server integrations, the secret is only shown when it's created
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int        `json:"createdBy"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// for create API key json payload, without expiresAt the key doesn't expire
+type CreateAPIKeyPayload struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=products:write orders:read orders:write"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type AuditStore interface {
+	CreateAuditEntry(entry AuditEntry) error
+}
+
+const (
+	AuditActionUserDeleted   = "user.deleted"
+	AuditActionUserSuspended   = "user.suspended"
+	AuditActionUserReactivated = "user.reactivated"
+	AuditActionPasswordResetForced = "user.password_reset_forced"
+	AuditActionImpersonationStarted = "impersonation.started"
+	// one per request made with an impersonation token
+	AuditActionImpersonatedRequest = "impersonation.request"
+	AuditActionAPIKeyCreated = "api_key.created"
+	AuditActionAPIKeyRevoked = "api_key.revoked"
+)
+
+// who did what to what, never put personal data in Details
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	ActorID    int       `json:"actorID"` // 0 for the system
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetID"`
+	Details    string    `json:"details"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// for DELETE /me json payload
+type DeleteAccountPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+}
+
+// for PATCH /me json payload, missing fields are left as they are.
+// changing the email needs the current password
+type UpdateProfilePayload struct {
+	FirstName       *string `json:"firstName" validate:"omitempty,min=2,max=50"`
+	LastName        *string `json:"lastName" validate:"omitempty,min=2,max=50"`
+	Email           *string `json:"email" validate:"omitempty,email"`
+	CurrentPassword string  `json:"currentPassword" validate:"required_with=Email"`
+}
+
+// for admin suspend user json payload, the reason goes to the audit log so keep personal data out of it
+type SuspendUserPayload struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// for admin impersonate user json payload, e.g. the support ticket
+type ImpersonateUserPayload struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// for change password json payload
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+// for resend verification email json payload
+type ResendVerificationPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// for forgot password json payload
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// for reset password json payload
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type Mailer interface {
+	Send(email Email) error
+}
+
+type Email struct {
+	To      string
+	Subject string
+	Body    string
 }
 
 // for login json payload
@@ -32,11 +350,62 @@ type LoginUserPayload struct {
 	Password  string `json:"password" validate:"required"`
 }
 
+type SessionStore interface {
+	CreateRefreshToken(token RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(oldID int, next RefreshToken) error
+	RevokeSession(sessionID string) error
+	RevokeUserSessions(userID int) error
+	IsSessionActive(sessionID string) (bool, error)
+	CreateSession(session Session) error
+	GetSessionByID(sessionID string) (*Session, error)
+	// sessions that weren't revoked and can still be refreshed, most recently seen first
+	GetActiveSessionsByUserID(userID int) ([]Session, error)
+	TouchSession(sessionID string, lastSeenAt time.Time) error
+}
+
+// a logged in device, the refresh tokens of the session share its ID
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"userID"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	// the session of the request listing them
+	Current bool `json:"current"`
+}
+
+// returned by RotateRefreshToken when the old token was already rotated or revoked
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+// only the sha256 of the refresh token is stored, the plain token is given to the client once.
+// every token issued from the same login shares a SessionID (the token family)
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userID"`
+	SessionID string     `json:"sessionID"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// for refresh token json payload
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// soft deleted products are left out of GetProducts only, orders still point to them
 type ProductStore interface{
-	GetProducts()([]Product, error)
+	GetProducts(query ProductQuery) ([]Product, error)
+	GetProductByID(id int) (*Product, error)
 	GetProductsByIDs(products []int) ([]Product, error)
-	CreateProduct(product Product) error
+	// creates the default variant too, from product.Variants[0] when set (SKU "P<id>" when empty)
+	CreateProduct(product Product) (int, error)
 	UpdateProduct(product Product) error
+	DeleteProduct(id int) error
 }
 
 type Product struct {
@@ -44,56 +413,333 @@ type Product struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Image       string    `json:"image"`
+	// base price, variants can override it
 	Price       float64   `json:"price"`
+	// stock of all variants together
 	Quantity    int      `json:"quantity"`
 	CreatedAt   time.Time `json:"createdAt"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+	// only filled for a single product, GET /products/{id}
+	Options     []ProductOption `json:"options,omitempty"`
+	Variants    []Variant `json:"variants,omitempty"`
+}
+
+// stock and price live on the variants, every product has a default one
+type VariantStore interface {
+	GetOptions(productID int) ([]ProductOption, error)
+	// replaces the option types of the product, in this order
+	SetOptions(productID int, names []string) error
+	// deleted variants are left out, the default comes first
+	GetVariantsByProductIDs(productIDs []int) ([]Variant, error)
+	GetVariantByID(id int) (*Variant, error)
+	GetVariantBySKU(sku string) (*Variant, error)
+	CreateVariant(Variant) (int, error)
+	// making it the default takes that from the other variants of the product
+	UpdateVariant(Variant) error
+	DeleteVariant(id int) error
+}
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// an option type of a product, like size or color
+type ProductOption struct {
+	ID        int    `json:"id"`
+	ProductID int    `json:"productID"`
+	Name      string `json:"name"`
+	Position  int    `json:"position"`
+}
+
+// one SKU of a product, e.g. the red one in size M
+type Variant struct {
+	ID        int               `json:"id"`
+	ProductID int               `json:"productID"`
+	SKU       string            `json:"sku"`
+	// option name => value, {"size": "M", "color": "red"}. empty for the default variant of a simple product
+	Options   map[string]string `json:"options"`
+	// nil to use the price of the product
+	Price     *float64          `json:"price"`
+	Quantity  int               `json:"quantity"`
+	// empty to use the image of the product
+	Image     string            `json:"image"`
+	IsDefault bool              `json:"isDefault"`
+	CreatedAt time.Time         `json:"createdAt"`
+	DeletedAt *time.Time        `json:"deletedAt,omitempty"`
+}
+
+// what one unit of the variant costs
+func (v Variant) UnitPrice(product Product) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return product.Price
+}
+
+// for PUT /products/{id}/options
+type ProductOptionsPayload struct {
+	Options []string `json:"options" validate:"required,dive,required,max=50"`
+}
+
+// for create variant payload
+type CreateVariantPayload struct {
+	SKU       string            `json:"sku" validate:"required,max=64"`
+	Options   map[string]string `json:"options" validate:"dive,keys,required,endkeys,required,max=100"`
+	Price     *float64          `json:"price" validate:"omitempty,gt=0"`
+	Quantity  int               `json:"quantity" validate:"min=0"`
+	Image     string            `json:"image" validate:"max=255"`
+	IsDefault bool              `json:"isDefault"`
+}
+
+// for PATCH /products/{id}/variants/{variantID}, only the fields sent are changed.
+// {"quantity": 10} restocks it
+type PatchVariantPayload struct {
+	SKU       *string            `json:"sku" validate:"omitempty,min=1,max=64"`
+	Options   *map[string]string `json:"options" validate:"omitempty,dive,keys,required,endkeys,required,max=100"`
+	Price     *float64           `json:"price" validate:"omitempty,gt=0"`
+	// back to the price of the product
+	ClearPrice bool              `json:"clearPrice"`
+	Quantity  *int               `json:"quantity" validate:"omitempty,min=0"`
+	Image     *string            `json:"image" validate:"omitempty,max=255"`
+	IsDefault *bool              `json:"isDefault"`
+}
+
+// full-text search over the name and description of the products in the catalog
+type SearchIndex interface {
+	// add or replace the product, deleted products are removed
+	Index(product Product) error
+	Remove(productID int) error
+	// best matches first, typos in the query still find the product
+	Search(query string, limit int) ([]SearchResult, error)
+}
+
+type SearchResult struct {
+	Product Product `json:"product"`
+	Score float64 `json:"score"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// HTML escaped, the matches are wrapped in <mark>. the description is cut around the first match
+type SearchHighlights struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+}
+
+const (
+	ProductSortNewest = "-createdAt"
+	ProductSortOldest = "createdAt"
+	ProductSortPrice = "price"
+	ProductSortPriceDesc = "-price"
+	ProductSortName = "name"
+	ProductSortNameDesc = "-name"
+)
+
+// what GetProducts returns, nil/zero fields don't filter
+type ProductQuery struct {
+	// one of the ProductSort constants, ties are broken by id
+	Sort string
+	MinPrice *float64
+	MaxPrice *float64
+	InStock bool
+	CreatedAfter *time.Time
+	// only products in one of these categories
+	CategoryIDs []int
+	// continue after this product in the sort order (keyset pagination)
+	After *ProductCursor
+	Limit int
+}
+
+// the sort key of the last product of a page
+type ProductCursor struct {
+	ID int `json:"id"`
+	Price float64 `json:"price,omitempty"`
+	Name string `json:"name,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
-// for create product payload
+// for create product payload, the quantity is the stock of the default variant
 type CreateProductPayload struct{
 	Name        string    `json:"name" validate:"required"`
 	Description string    `json:"description" validate:"required"`
 	Image       string    `json:"image" validate:"required"`
 	Price       float64   `json:"price" validate:"required"`
 	Quantity    int      `json:"quantity" validate:"required"`
+	// of the default variant, "P<product id>" when empty
+	SKU         string    `json:"sku" validate:"max=64"`
+}
+
+// for PUT /products/{id}, replaces every field. stock is set on the variants
+type UpdateProductPayload struct{
+	Name        string    `json:"name" validate:"required"`
+	Description string    `json:"description" validate:"required"`
+	Image       string    `json:"image" validate:"required"`
+	Price       float64   `json:"price" validate:"required,gt=0"`
+}
+
+// for PATCH /products/{id}, only the fields sent are changed
+type PatchProductPayload struct{
+	Name        *string   `json:"name" validate:"omitempty,min=1"`
+	Description *string   `json:"description" validate:"omitempty,min=1"`
+	Image       *string   `json:"image" validate:"omitempty,min=1"`
+	Price       *float64  `json:"price" validate:"omitempty,gt=0"`
 }
 
 type OrderStore interface{
-	CreateOrder(Order) (int, error)
-	CreateOrderItem(OrderItem) error
+	// takes the stock of the item variants and creates the order with its items, all or nothing.
+	// fails with ErrInsufficientStock when a variant doesn't have enough left
+	PlaceOrder(order Order, items []OrderItem) (int, error)
 	UpdateOrder(order Order) error
 	GetOrderByID(orderID int) (*Order, error)
 	GetOrdersByUserID(userID int) ([]Order, error)
+	GetOrderItemsByOrderID(orderID int) ([]OrderItem, error)
+	// the id of the guest customer with that email, created on their first order
+	CreateGuestCustomer(email string) (int, error)
 }
 
 type Order struct{
 	ID int `json:"id"`
+	// 0 for guest orders that haven't been claimed by an account
 	UserID int `json:"userID"`
+	GuestCustomerID *int `json:"guestCustomerID,omitempty"`
 	Total float64 `json:"total"`
 	Status string `json:"status"`
 	Address string `json:"address"`
 	CreatedAt time.Time `json:"createdAt"`
+	// copy of the address at purchase time, editing the address book doesn't change it.
+	// nil for orders from before the address book
+	ShippingAddress *PostalAddress `json:"shippingAddress,omitempty"`
 }
 
 type OrderItem struct{
 	ID int `json:"id"`
 	OrderID int `json:"orderID"`
 	ProductID int `json:"productID"`
+	// nil for items from before variants
+	VariantID *int `json:"variantID,omitempty"`
 	Quantity int `json:"quantity"`
+	// unit price of the variant at purchase time
 	Price float64 `json:"price"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
 type CartItem struct{
 	ProductID int `json:"productID"`
+	// 0 for the default variant of the product
+	VariantID int `json:"variantID"`
 	Quantity int `json:"quantity"`
 }
 
+// either a saved address of the user or one typed in at checkout
 type CartCheckoutPayload struct{
-	Items []CartItem `json:"items" validate:"required"`
-	Address string `json:"address" validate:"required"`
+	Items []CartItem `json:"items" validate:"required,min=1,dive"`
+	AddressID int `json:"addressID" validate:"required_without=Address,excluded_with=Address"`
+	Address *PostalAddress `json:"address" validate:"required_without=AddressID,omitempty"`
+}
+
+type CategoryStore interface {
+	// every category, ordered by position then name
+	GetCategories() ([]Category, error)
+	GetCategoryByID(id int) (*Category, error)
+	GetCategoryBySlug(slug string) (*Category, error)
+	// the category and every category below it
+	GetDescendantCategoryIDs(categoryID int) ([]int, error)
+	CreateCategory(Category) (int, error)
+	UpdateCategory(Category) error
+	DeleteCategory(id int) error
+	GetProductCategories(productID int) ([]Category, error)
+	// replaces the categories of the product
+	SetProductCategories(productID int, categoryIDs []int) error
+}
+
+type Category struct {
+	ID        int        `json:"id"`
+	// nil for top level categories
+	ParentID  *int       `json:"parentID"`
+	Name      string     `json:"name"`
+	Slug      string     `json:"slug"`
+	// order among the categories with the same parent
+	Position  int        `json:"position"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// only filled in the tree of GET /categories
+	Children  []Category `json:"children,omitempty"`
+}
+
+// for create and update category json payload, the slug is made from the name when empty
+type CategoryPayload struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Slug     string `json:"slug" validate:"omitempty,max=100"`
+	ParentID *int   `json:"parentID" validate:"omitempty,min=1"`
+	Position int    `json:"position"`
+}
+
+type ProductCategoriesPayload struct {
+	CategoryIDs []int `json:"categoryIDs" validate:"required,dive,min=1"`
+}
+
+type AddressStore interface {
+	CreateAddress(Address) (int, error)
+	GetAddressByID(id int) (*Address, error)
+	GetAddressesByUserID(userID int) ([]Address, error)
+	UpdateAddress(Address) error
+	DeleteAddress(id int) error
+}
+
+// the address itself, shared by the address book, checkout and the copy kept on orders
+type PostalAddress struct {
+	Name       string `json:"name" validate:"required,max=100"`
+	Line1      string `json:"line1" validate:"required,max=200"`
+	Line2      string `json:"line2" validate:"max=200"`
+	City       string `json:"city" validate:"required,max=100"`
+	Region     string `json:"region" validate:"max=100"`
+	PostalCode string `json:"postalCode" validate:"max=20"`
+	// ISO 3166-1 alpha-2
+	Country string `json:"country" validate:"required,iso3166_1_alpha2"`
+	Phone   string `json:"phone" validate:"omitempty,e164"`
+}
+
+// one line, for orders.address and emails
+func (a PostalAddress) String() string {
+	parts := make([]string, 0, 8)
+	for _, part := range []string{a.Name, a.Line1, a.Line2, strings.TrimSpace(a.PostalCode + " " + a.City), a.Region, a.Country, a.Phone} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// an entry of the user's address book. a user has at most one default of each kind
+type Address struct {
+	ID     int `json:"id"`
+	UserID int `json:"userID"`
+	PostalAddress
+	IsDefaultShipping bool      `json:"isDefaultShipping"`
+	IsDefaultBilling  bool      `json:"isDefaultBilling"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// for create and update address json payload
+type AddressPayload struct {
+	PostalAddress
+	IsDefaultShipping bool `json:"isDefaultShipping"`
+	IsDefaultBilling  bool `json:"isDefaultBilling"`
+}
+
+// for guest checkout json payload, the email gets the confirmation and the order lookup link
+type GuestCheckoutPayload struct {
+	CartCheckoutPayload
+	Email string `json:"email" validate:"required,email"`
 }
 
 type OrderCancelPayload struct{
 	OrderID int `json:"orderID" validate:"required"`
 }
+
+// for admin order status update payload
+type OrderStatusPayload struct {
+	Status string `json:"status" validate:"required,oneof=pending completed cancelled"`
+}
+
+// for admin user role update payload
+type UserRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=customer staff admin"`
+}
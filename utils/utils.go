@@ -3,8 +3,11 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
+	"github.com/faldeus0092/go-ecom/config"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -27,4 +30,26 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 
 func WriteError(w http.ResponseWriter, status int, err error)  {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
-}
\ No newline at end of file
+}
+
+// 400 with the problems per field, {"error": "invalid payload", "fields": {"password": ["..."]}}
+func WriteFieldErrors(w http.ResponseWriter, fields map[string][]string) {
+	WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid payload", "fields": fields})
+}
+
+/* The address of the client, X-Forwarded-For is only trusted behind a proxy (TRUST_PROXY_HEADERS).
+*	only the last entry is taken, our proxy appended it. the ones before come from the client and can be made up
+ */
+func ClientIP(r *http.Request) string {
+	if config.Envs.TrustProxyHeaders {
+		entries := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		if last := strings.TrimSpace(entries[len(entries)-1]); last != "" {
+			return last
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}